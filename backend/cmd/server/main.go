@@ -3,11 +3,14 @@ package main
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"rankmyrepo/internal/api"
 	"rankmyrepo/internal/completion"
 	"rankmyrepo/internal/parser"
 	"rankmyrepo/internal/processor"
 	"rankmyrepo/internal/ranking"
+	"rankmyrepo/internal/repocache"
+	"strconv"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
@@ -26,7 +29,92 @@ func main() {
 		"application/x-shellscript": true,
 	}
 
-	parser, err := parser.NewParser(textMimeTypes)
+	var repoCache *repocache.Cache
+	if cacheDir := os.Getenv("REPO_CACHE_DIR"); cacheDir != "" {
+		maxBytes := int64(2 << 30)
+		if v := os.Getenv("REPO_CACHE_MAX_BYTES"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				log.Fatalf("invalid REPO_CACHE_MAX_BYTES: %v", err)
+			}
+			maxBytes = n
+		}
+
+		c, err := repocache.NewCache(cacheDir, maxBytes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repoCache = c
+	}
+
+	var credentials *parser.CredentialStore
+	if path := os.Getenv("GIT_CREDENTIALS_FILE"); path != "" {
+		store, err := parser.LoadCredentialStore(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		credentials = store
+	}
+
+	shallowThreshold := int64(500 << 20)
+	if v := os.Getenv("CLONE_SHALLOW_THRESHOLD"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid CLONE_SHALLOW_THRESHOLD: %v", err)
+		}
+		shallowThreshold = n
+	}
+
+	limits := parser.Limits{
+		MaxFileBytes:  1 << 20,
+		MaxFiles:      20_000,
+		MaxTotalBytes: 100 << 20,
+		MaxBlameFiles: 200,
+		MaxBlameBytes: 5 << 20,
+	}
+	if v := os.Getenv("PARSE_MAX_FILE_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid PARSE_MAX_FILE_BYTES: %v", err)
+		}
+		limits.MaxFileBytes = n
+	}
+	if v := os.Getenv("PARSE_MAX_FILES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid PARSE_MAX_FILES: %v", err)
+		}
+		limits.MaxFiles = n
+	}
+	if v := os.Getenv("PARSE_MAX_TOTAL_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid PARSE_MAX_TOTAL_BYTES: %v", err)
+		}
+		limits.MaxTotalBytes = n
+	}
+	if v := os.Getenv("PARSE_MAX_BLAME_FILES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid PARSE_MAX_BLAME_FILES: %v", err)
+		}
+		limits.MaxBlameFiles = n
+	}
+	if v := os.Getenv("PARSE_MAX_BLAME_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid PARSE_MAX_BLAME_BYTES: %v", err)
+		}
+		limits.MaxBlameBytes = n
+	}
+
+	parser, err := parser.NewParser(textMimeTypes, parser.Options{
+		Cache:            repoCache,
+		Credentials:      credentials,
+		ShallowThreshold: shallowThreshold,
+		LocalRoots:       filepath.SplitList(os.Getenv("LOCAL_SOURCE_ROOTS")),
+		Limits:           limits,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -37,7 +125,52 @@ func main() {
 		log.Fatal(err)
 	}
 
-	ranker := ranking.NewEngine(r8, 50)
+	var scoreCache ranking.ScoreCache = ranking.NewMemoryScoreCache(100_000)
+	if path := os.Getenv("SCORE_CACHE_PATH"); path != "" {
+		fileCache, err := ranking.NewFileScoreCache(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer fileCache.Close()
+
+		scoreCache = ranking.NewTieredScoreCache(scoreCache, fileCache)
+	}
+
+	providers := map[string]ranking.ScoringProvider{
+		"fireworks": ranking.NewFireworksProvider(os.Getenv("FIREWORKS_API_KEY"), envOr("FIREWORKS_MODEL", "accounts/fireworks/models/llama-v3p2-3b-instruct")),
+		"replicate": ranking.NewReplicateProvider(r8, envOr("REPLICATE_MODEL", "meta/meta-llama-3-8b-instruct")),
+	}
+	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+		model := os.Getenv("OPENAI_MODEL")
+		if model == "" {
+			log.Fatal("OPENAI_MODEL must be set along with OPENAI_BASE_URL")
+		}
+		providers["openai"] = ranking.NewOpenAICompatibleProvider("openai", baseURL, os.Getenv("OPENAI_API_KEY"), model)
+	}
+	if baseURL := os.Getenv("OLLAMA_URL"); baseURL != "" {
+		providers["ollama"] = ranking.NewOllamaProvider(baseURL, envOr("OLLAMA_MODEL", "llama3.2:3b"))
+	}
+
+	var rateLimiter *ranking.RateLimiter
+	if v := os.Getenv("RANKING_RATE_LIMIT"); v != "" {
+		perSecond, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Fatalf("invalid RANKING_RATE_LIMIT: %v", err)
+		}
+		rateLimiter, err = ranking.NewRateLimiter(perSecond, int(max(perSecond, 1)))
+		if err != nil {
+			log.Fatalf("invalid RANKING_RATE_LIMIT: %v", err)
+		}
+	}
+
+	ranker, err := ranking.NewEngine(providers, envOr("RANKING_PROVIDER", "fireworks"), 50, ranking.Options{
+		ScoreCache:    scoreCache,
+		RateLimiter:   rateLimiter,
+		FailurePolicy: ranking.FailurePolicy(envOr("RANKING_FAILURE_POLICY", string(ranking.FailurePolicyReport))),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	anthropicClient := anthropic.NewClient(option.WithAPIKey(os.Getenv("ANTHROPIC_API_KEY")))
 	if err != nil {
@@ -46,7 +179,42 @@ func main() {
 
 	completion := completion.NewCompletion(anthropicClient)
 
-	processor := processor.NewProcessor(parser, ranker, completion)
+	var embedder ranking.Embedder = ranking.NewHashEmbedder(1024)
+	if os.Getenv("EMBEDDER") == "fireworks" {
+		embedder = ranking.NewOpenAIEmbedder("https://api.fireworks.ai/inference/v1", os.Getenv("FIREWORKS_API_KEY"), "nomic-ai/nomic-embed-text-v1.5")
+	}
+
+	// The pre-filter is optional; without PREFILTER_TOP_K every chunk is ranked.
+	var prefilterTopK int
+	if v := os.Getenv("PREFILTER_TOP_K"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid PREFILTER_TOP_K: %v", err)
+		}
+		prefilterTopK = n
+	}
+
+	engines := map[string]ranking.RankingEngine{
+		ranking.RankerBM25:      ranking.NewBM25Engine(1.2, 0.75),
+		ranking.RankerEmbedding: ranking.NewEmbeddingEngine(embedder, 64),
+		ranking.RankerLLM:       ranker,
+	}
+
+	hybrid := ranking.NewHybridEngine(engines, map[string]float64{
+		ranking.RankerBM25:      1,
+		ranking.RankerEmbedding: 1,
+	})
+
+	var prefilter *ranking.Prefilter
+	if prefilterTopK > 0 {
+		engine := engines[ranking.RankerEmbedding]
+		if os.Getenv("PREFILTER") == ranking.RankerBM25 {
+			engine = engines[ranking.RankerBM25]
+		}
+		prefilter = ranking.NewPrefilter(engine, prefilterTopK)
+	}
+
+	processor := processor.NewProcessor(parser, prefilter, ranker, hybrid, completion)
 
 	handler, err := api.NewHandler(processor)
 	if err != nil {
@@ -70,9 +238,17 @@ func main() {
 	})
 
 	r.POST("/query", handler.Query)
+	r.POST("/query/archive", handler.QueryArchive)
 
 	log.Printf("Server starting on :8080")
 	if err := r.Run(":8080"); err != nil {
 		log.Fatal(err)
 	}
 }
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
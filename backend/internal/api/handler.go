@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"rankmyrepo/internal/common"
+	"rankmyrepo/internal/parser"
 	"rankmyrepo/internal/processor"
 	"rankmyrepo/internal/ranking"
+	"rankmyrepo/internal/repocache"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
 type RankingResponse struct {
@@ -46,29 +51,107 @@ func (h *Handler) Query(c *gin.Context) {
 		return
 	}
 
+	h.stream(c, &req)
+}
+
+// maxArchiveUpload caps the size of archives posted to QueryArchive.
+const maxArchiveUpload = 256 << 20
+
+// QueryArchive answers a query about the files of an uploaded .zip, .tar.gz or .tar
+// archive. The multipart form carries the archive in the "archive" field and the
+// request as JSON in the "request" field.
+func (h *Handler) QueryArchive(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxArchiveUpload)
+
+	var req ranking.RankingRequest
+	if err := json.Unmarshal([]byte(c.PostForm("request")), &req); err != nil {
+		writeSSEEvent(c, common.QueryResponseChunk{
+			Type:  common.EventTypeError,
+			Error: "Invalid request body",
+		})
+		return
+	}
+
+	header, err := c.FormFile("archive")
+	if err != nil {
+		writeSSEEvent(c, common.QueryResponseChunk{
+			Type:  common.EventTypeError,
+			Error: fmt.Sprintf("Missing archive or archive larger than %d MB", maxArchiveUpload>>20),
+		})
+		return
+	}
+
+	upload, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		writeSSEEvent(c, common.QueryResponseChunk{
+			Type:  common.EventTypeError,
+			Error: "Failed to store archive",
+		})
+		return
+	}
+	upload.Close()
+	defer os.Remove(upload.Name())
+
+	if err := c.SaveUploadedFile(header, upload.Name()); err != nil {
+		writeSSEEvent(c, common.QueryResponseChunk{
+			Type:  common.EventTypeError,
+			Error: "Failed to store archive",
+		})
+		return
+	}
+
+	req.Archive = upload.Name()
+	req.ArchiveName = header.Filename
+
+	h.stream(c, &req)
+}
+
+// stream runs the request through the processor and forwards its events to the
+// client as server-sent events. Requests that fail before the first event with an
+// error errorStatus knows are answered with that status instead.
+func (h *Handler) stream(c *gin.Context, req *ranking.RankingRequest) {
 	resultChan := make(chan common.QueryResponseChunk)
 	errChan := make(chan error, 1)
 
 	go func() {
-		err := h.processor.ProcessRankingRequestStream(c.Request.Context(), &req, resultChan)
+		err := h.processor.ProcessRankingRequestStream(c.Request.Context(), req, resultChan)
 		if err != nil {
 			errChan <- err
 		}
 		close(resultChan)
 	}()
 
+	// Keep draining events after the client is gone, so the processor can finish and
+	// release the repository it parsed.
+	defer func() {
+		go func() {
+			for range resultChan {
+			}
+		}()
+	}()
+
+	var written bool
 	for {
 		select {
 		case chunk, ok := <-resultChan:
 			if !ok {
+				// The processor sends its error before closing resultChan, so the
+				// error may still be waiting when the closed channel is picked first.
+				select {
+				case err := <-errChan:
+					writeError(c, err, written)
+				default:
+				}
 				return
 			}
 			writeSSEEvent(c, chunk)
+			written = true
 		case err := <-errChan:
-			writeSSEEvent(c, common.QueryResponseChunk{
-				Type: common.EventTypeError,
-				Error: err.Error(),
-			})
+			writeError(c, err, written)
 			return
 		case <-c.Request.Context().Done():
 			return
@@ -76,6 +159,40 @@ func (h *Handler) Query(c *gin.Context) {
 	}
 }
 
+// writeError reports a failed request, with the status errorStatus knows for the
+// error if no event was written yet and as an error event otherwise.
+func writeError(c *gin.Context, err error, written bool) {
+	if status, ok := errorStatus(err); ok && !written {
+		c.Header("Content-Type", "application/json")
+		c.JSON(status, APIError{
+			Error:   http.StatusText(status),
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+	writeSSEEvent(c, common.QueryResponseChunk{
+		Type: common.EventTypeError,
+		Error: err.Error(),
+	})
+}
+
+// errorStatus maps errors that make a repository impossible to parse to an HTTP status.
+func errorStatus(err error) (int, bool) {
+	var walkErr *parser.WalkError
+	switch {
+	case errors.As(err, &walkErr):
+		return http.StatusInternalServerError, true
+	case errors.Is(err, repocache.ErrAuthRequired), errors.Is(err, transport.ErrAuthenticationRequired):
+		return http.StatusUnauthorized, true
+	case errors.Is(err, transport.ErrAuthorizationFailed):
+		return http.StatusForbidden, true
+	case errors.Is(err, repocache.ErrUnknownRef), errors.Is(err, transport.ErrRepositoryNotFound):
+		return http.StatusNotFound, true
+	}
+	return 0, false
+}
+
 func writeSSEEvent(c *gin.Context, event common.QueryResponseChunk) {
 	data, _ := json.Marshal(event)
 	c.Writer.Write([]byte(fmt.Sprintf("data: %s\n\n", data)))
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"rankmyrepo/internal/parser"
+	"rankmyrepo/internal/processor"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryReportsFastFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Without local roots the request fails before the repository is resolved, so the
+	// processor closes its event channel right after reporting the error.
+	p, err := parser.NewParser(map[string]bool{"text/": true}, parser.Options{})
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	defer p.Cleanup()
+
+	h, err := NewHandler(processor.NewProcessor(p, nil, nil, nil, nil))
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"Query": "files", "RepoPath": "`+t.TempDir()+`"}`))
+
+	h.Query(c)
+
+	if body := recorder.Body.String(); !strings.Contains(body, "local sources are not enabled") {
+		t.Errorf("expected the error to be reported, got %q", body)
+	}
+}
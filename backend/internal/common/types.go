@@ -10,16 +10,24 @@ import (
 type QueryEventType string
 
 const (
+	EventTypeRepositoryResolved QueryEventType = "repository.resolved"
+	EventTypeParserSkipped    QueryEventType = "parser.skipped"
+	EventTypeParserWarning    QueryEventType = "parser.warning"
 	EventTypeRankingParsed    QueryEventType = "ranking.parsed"
 	EventTypeRankingRanked    QueryEventType = "ranking.ranked"
+	EventTypeRankingFailed    QueryEventType = "ranking.failed"
 	EventTypeCompletionDelta  QueryEventType = "completion.delta"
 	EventTypeError            QueryEventType = "error"
 )
 
 type QueryResponseChunk struct {
 	Type        QueryEventType `json:"type"`
+	Revision    *parser.Revision `json:"revision,omitempty"`
+	SkippedFile *parser.SkippedFile `json:"skipped_file,omitempty"`
+	Warning     *parser.ParseWarning `json:"warning,omitempty"`
 	ParsedChunk *parser.ParsedChunk `json:"parsed_chunk,omitempty"`
 	RankedChunk *ranking.RankedChunk `json:"ranked_chunk,omitempty"`
+	FailedChunk *ranking.FailedChunk `json:"failed_chunk,omitempty"`
 	Completion  string        `json:"completion,omitempty"`
 	Error       string        `json:"error,omitempty"`
 }
\ No newline at end of file
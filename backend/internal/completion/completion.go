@@ -2,6 +2,7 @@ package completion
 
 import (
 	"context"
+	"rankmyrepo/internal/parser"
 	"rankmyrepo/internal/ranking"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -19,8 +20,16 @@ func NewCompletion(anthropicClient *anthropic.Client) *Completion {
 }
 
 func (c *Completion) Run(ctx context.Context, query string, chunks []ranking.RankedChunk) *ssestream.Stream[anthropic.MessageStreamEvent] {
-	prompt := buildCompletionPrompt(query, chunks)
+	return c.stream(ctx, buildCompletionPrompt(query, chunks))
+}
+
+// RunReview answers a question about the change from the base of the revision to its
+// commit, framing the answer as a review of that change.
+func (c *Completion) RunReview(ctx context.Context, query string, revision parser.Revision, chunks []ranking.RankedChunk) *ssestream.Stream[anthropic.MessageStreamEvent] {
+	return c.stream(ctx, buildReviewPrompt(query, revision, chunks))
+}
 
+func (c *Completion) stream(ctx context.Context, prompt string) *ssestream.Stream[anthropic.MessageStreamEvent] {
 	messageParams := anthropic.MessageNewParams{
 		Model: anthropic.F(anthropic.ModelClaude3_5SonnetLatest),
 		Messages: anthropic.F([]anthropic.MessageParam{
@@ -2,20 +2,53 @@ package completion
 
 import (
 	"fmt"
+	"rankmyrepo/internal/parser"
 	"rankmyrepo/internal/ranking"
 )
 
 func buildCompletionPrompt(query string, chunks []ranking.RankedChunk) string {
 	return `Answer the following user query with the additional context provided in the chunks.
+	When you refer to code from a chunk, cite it by its location in the form file.go:120-160.
 
 	<context>` + buildContext(chunks) + `</context>
 
 	<query>` + query + `</query>`
 }
 
+func buildReviewPrompt(query string, revision parser.Revision, chunks []ranking.RankedChunk) string {
+	var hunks, others []ranking.RankedChunk
+	for _, chunk := range chunks {
+		if chunk.ParsedChunk.Hunk {
+			hunks = append(hunks, chunk)
+		} else {
+			others = append(others, chunk)
+		}
+	}
+
+	head := revision.Ref
+	if head == "" {
+		head = "the default branch"
+	}
+
+	return `Review the change from ` + fmt.Sprintf("%s (%.12s) to %s (%.12s)", revision.BaseRef, revision.BaseCommit, head, revision.Commit) + ` and answer the following user query about it.
+	The hunks of the change are provided in <change> as unified diffs, where added lines start with + and removed lines with -. Code of the new version that the change may affect is provided in <context>.
+	Look for bugs the change introduces, callers and tests it breaks or leaves outdated, and behaviour it changes, and say so when the provided code is not enough to tell.
+	When you refer to code from a chunk, cite it by its location in the form file.go:120-160.
+
+	<change>` + buildContext(hunks) + `</change>
+
+	<context>` + buildContext(others) + `</context>
+
+	<query>` + query + `</query>`
+}
+
 func buildContext(chunks []ranking.RankedChunk) (context string) {
 	for _, chunk := range chunks {
-		context += fmt.Sprintf("Chunk: %s\nContent: %s\n\n", chunk.ParsedChunk.FilePath, chunk.ParsedChunk.Content)
+		context += fmt.Sprintf("Chunk: %s\nLanguage: %s\n", chunk.ParsedChunk.Location(), chunk.ParsedChunk.Language)
+		if chunk.ParsedChunk.LastCommit != nil {
+			context += fmt.Sprintf("Last changed in: %s\n", chunk.ParsedChunk.LastCommit)
+		}
+		context += fmt.Sprintf("Content: %s\n\n", chunk.ParsedChunk.Content)
 	}
 
 	return context
@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxExtractedBytes caps the size of an extracted archive, guarding against archives
+// that decompress to far more than was uploaded.
+const maxExtractedBytes = 2 << 30
+
+var errArchiveTooLarge = errors.New("archive is too large when extracted")
+
+// extractArchive extracts the regular files of a .zip, .tar.gz/.tgz or .tar archive
+// into dir. Symlinks and entries pointing outside of dir are never written. It returns
+// the SHA-256 of the archive, which identifies its contents like a commit SHA would.
+func extractArchive(ctx context.Context, path, name, dir string) (string, error) {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+
+	remaining := int64(maxExtractedBytes)
+
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = extractZip(ctx, path, dir, &remaining)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		err = extractTar(ctx, path, dir, true, &remaining)
+	case strings.HasSuffix(lower, ".tar"):
+		err = extractTar(ctx, path, dir, false, &remaining)
+	default:
+		return "", fmt.Errorf("unsupported archive format %q, expected .zip, .tar.gz or .tar", filepath.Ext(name))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to extract archive: %w", err)
+	}
+
+	return digest, nil
+}
+
+func extractZip(ctx context.Context, path, dir string, remaining *int64) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveEntry(dir, f.Name, rc, remaining)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractTar(ctx context.Context, path, dir string, gzipped bool, remaining *int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if gzipped {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := writeArchiveEntry(dir, header.Name, tr, remaining); err != nil {
+			return err
+		}
+	}
+}
+
+func writeArchiveEntry(dir, name string, r io.Reader, remaining *int64) error {
+	name = filepath.FromSlash(strings.TrimPrefix(name, "./"))
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("entry %q points outside of the archive", name)
+	}
+
+	target := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, io.LimitReader(r, *remaining+1))
+	*remaining -= n
+	if err != nil {
+		return err
+	}
+	if *remaining < 0 {
+		return errArchiveTooLarge
+	}
+	return nil
+}
+
+// singleTopLevelDir returns the only directory in dir if there is nothing else in it,
+// as in archives of GitHub and GitLab repositories, so file paths start at the
+// repository root.
+func singleTopLevelDir(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to read archive: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Boundary marks the first line (1-based) of a syntactic unit such as a function,
+// method, type or class.
+type Boundary struct {
+	Line int
+	Name string
+}
+
+// Splitter finds the unit boundaries of a single source file. Implementations only
+// need to report where units start; the Chunker takes care of turning boundaries
+// into contiguous segments, merging tiny units and windowing oversized ones.
+type Splitter interface {
+	Boundaries(content []byte) ([]Boundary, error)
+}
+
+// Segment is a contiguous range of lines cut out of a file by the Chunker.
+type Segment struct {
+	Name      string
+	StartLine int
+	EndLine   int
+	StartByte int
+	EndByte   int
+	Content   string
+}
+
+type Chunker struct {
+	splitters map[string]Splitter
+	fallback  *LineSplitter
+	minLines  int
+	maxLines  int
+}
+
+// NewChunker returns a Chunker with the built-in splitters registered. Files with at
+// most maxLines lines are kept whole, units shorter than minLines are merged with
+// their neighbours and units longer than maxLines fall back to line windows.
+func NewChunker(minLines, maxLines int) *Chunker {
+	c := &Chunker{
+		splitters: make(map[string]Splitter),
+		fallback:  NewLineSplitter(maxLines, maxLines/10),
+		minLines:  minLines,
+		maxLines:  maxLines,
+	}
+
+	c.Register(".go", &GoSplitter{})
+	for ext, splitter := range patternSplitters() {
+		c.Register(ext, splitter)
+	}
+
+	return c
+}
+
+// Register associates a splitter with a file extension (e.g. ".py"), replacing any
+// splitter previously registered for it.
+func (c *Chunker) Register(ext string, splitter Splitter) {
+	c.splitters[strings.ToLower(ext)] = splitter
+}
+
+func (c *Chunker) Split(path string, content []byte) []Segment {
+	lines := lineOffsets(content)
+	total := len(lines)
+
+	if total == 0 {
+		return nil
+	}
+
+	if total <= c.maxLines {
+		return []Segment{newSegment(content, lines, "", 1, total)}
+	}
+
+	var boundaries []Boundary
+	if splitter, ok := c.splitters[strings.ToLower(filepath.Ext(path))]; ok {
+		b, err := splitter.Boundaries(content)
+		if err != nil {
+			log.Printf("splitter failed for %s, falling back to line windows: %v", path, err)
+		} else {
+			boundaries = b
+		}
+	}
+
+	var segments []Segment
+	for _, unit := range mergeUnits(unitsFromBoundaries(boundaries, total), c.minLines, c.maxLines) {
+		if unit.end-unit.start+1 > c.maxLines {
+			segments = append(segments, c.fallback.split(content, lines, unit.name, unit.start, unit.end)...)
+			continue
+		}
+		segments = append(segments, newSegment(content, lines, unit.name, unit.start, unit.end))
+	}
+
+	return segments
+}
+
+type unit struct {
+	name  string
+	start int
+	end   int
+}
+
+// unitsFromBoundaries cuts the lines 1..total into contiguous units, one per boundary.
+// Lines before the first boundary (package clauses, imports, headers) form their own unit.
+func unitsFromBoundaries(boundaries []Boundary, total int) []unit {
+	sort.SliceStable(boundaries, func(i, j int) bool {
+		return boundaries[i].Line < boundaries[j].Line
+	})
+
+	var units []unit
+	start, name := 1, ""
+	for _, b := range boundaries {
+		if b.Line <= start || b.Line > total {
+			if b.Line == start && name == "" {
+				name = b.Name
+			}
+			continue
+		}
+		units = append(units, unit{name: name, start: start, end: b.Line - 1})
+		start, name = b.Line, b.Name
+	}
+
+	return append(units, unit{name: name, start: start, end: total})
+}
+
+// mergeUnits folds units shorter than minLines into the following unit as long as
+// the result stays within maxLines.
+func mergeUnits(units []unit, minLines, maxLines int) []unit {
+	var merged []unit
+	for _, u := range units {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.end-last.start+1 < minLines && u.end-last.start+1 <= maxLines {
+				last.end = u.end
+				if last.name == "" {
+					last.name = u.name
+				} else if u.name != "" {
+					last.name += ", " + u.name
+				}
+				continue
+			}
+		}
+		merged = append(merged, u)
+	}
+	return merged
+}
+
+// lineOffsets returns the byte offset at which every line of content starts.
+func lineOffsets(content []byte) []int {
+	if len(content) == 0 {
+		return nil
+	}
+
+	offsets := []int{0}
+	for i, b := range content {
+		if b == '\n' && i+1 < len(content) {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+func newSegment(content []byte, lines []int, name string, start, end int) Segment {
+	startByte := lines[start-1]
+	endByte := len(content)
+	if end < len(lines) {
+		endByte = lines[end]
+	}
+
+	return Segment{
+		Name:      name,
+		StartLine: start,
+		EndLine:   end,
+		StartByte: startByte,
+		EndByte:   endByte,
+		Content:   string(content[startByte:endByte]),
+	}
+}
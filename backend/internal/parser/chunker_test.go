@@ -0,0 +1,64 @@
+package parser_test
+
+import (
+	"fmt"
+	"rankmyrepo/internal/parser"
+	"strings"
+	"testing"
+)
+
+func TestChunkerSplitsGoDeclarations(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("package example\n\nimport \"fmt\"\n\n")
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&src, "// Func%d prints its index.\nfunc Func%d() {\n", i, i)
+		for j := 0; j < 30; j++ {
+			fmt.Fprintf(&src, "\tfmt.Println(%d)\n", j)
+		}
+		src.WriteString("}\n\n")
+	}
+
+	chunker := parser.NewChunker(5, 60)
+	segments := chunker.Split("example.go", []byte(src.String()))
+
+	if len(segments) != 6 {
+		t.Fatalf("expected 6 segments, got %d", len(segments))
+	}
+
+	for i, segment := range segments {
+		if !strings.Contains(segment.Content, fmt.Sprintf("func Func%d()", i)) {
+			t.Errorf("segment %d does not contain Func%d: %q", i, i, segment.Name)
+		}
+		if i > 0 && !strings.HasPrefix(segment.Content, fmt.Sprintf("// Func%d", i)) {
+			t.Errorf("segment %d does not start with its doc comment", i)
+		}
+		if i > 0 && segment.StartLine != segments[i-1].EndLine+1 {
+			t.Errorf("segment %d is not contiguous with the previous one", i)
+		}
+	}
+}
+
+func TestChunkerFallsBackToLineWindows(t *testing.T) {
+	var src strings.Builder
+	for i := 0; i < 250; i++ {
+		fmt.Fprintf(&src, "line %d\n", i)
+	}
+
+	chunker := parser.NewChunker(5, 100)
+	segments := chunker.Split("notes.unknown", []byte(src.String()))
+
+	if len(segments) < 3 {
+		t.Fatalf("expected at least 3 line windows, got %d", len(segments))
+	}
+
+	last := segments[len(segments)-1]
+	if last.EndLine != 250 {
+		t.Errorf("expected last window to end at line 250, got %d", last.EndLine)
+	}
+
+	for _, segment := range segments {
+		if segment.EndLine-segment.StartLine+1 > 100 {
+			t.Errorf("window %d-%d exceeds 100 lines", segment.StartLine, segment.EndLine)
+		}
+	}
+}
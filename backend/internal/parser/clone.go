@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"rankmyrepo/internal/repocache"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// githubAPI is the base URL repository sizes are looked up at.
+var githubAPI = "https://api.github.com"
+
+// cloneOptions picks how the repository is cloned. Unless the request asks for a mode,
+// repositories of at least the shallow threshold are cloned shallowly, and sparsely
+// when the parsed files lie in known directories: the sparse paths of the request, or
+// else those its path prefix or include patterns are limited to. Everything else,
+// including commit SHAs that may not be reachable from a shallow clone, and requests
+// for the history or a review get the full history. Sizes are only known for GitHub
+// repositories, so repositories on other hosts are cloned in full unless the request
+// asks for another mode.
+func (p *Parser) cloneOptions(ctx context.Context, repoURL string, opts ParseOptions, creds *Credentials) (repocache.CloneOptions, error) {
+	clone := repocache.CloneOptions{
+		Mode:        opts.CloneMode,
+		SparsePaths: opts.SparsePaths,
+	}
+
+	sparsePaths := opts.SparsePaths
+	if len(sparsePaths) == 0 {
+		sparsePaths = newFileFilter(opts).sparsePaths()
+	}
+
+	switch opts.CloneMode {
+	case repocache.CloneFull:
+		return clone, nil
+	case repocache.CloneShallow:
+		if opts.needsHistory() {
+			return clone, errShallowClone
+		}
+		return clone, nil
+	case repocache.CloneSparse:
+		if len(sparsePaths) == 0 {
+			return clone, fmt.Errorf("sparse clones need sparse paths, a path prefix or include patterns anchored in a directory")
+		}
+		if opts.needsHistory() {
+			return clone, errShallowClone
+		}
+		clone.SparsePaths = sparsePaths
+		return clone, nil
+	case "":
+	default:
+		return clone, fmt.Errorf("unknown clone mode %q", opts.CloneMode)
+	}
+
+	clone.Mode = repocache.CloneFull
+	if p.shallowThreshold <= 0 || repocache.IsCommitSHA(opts.Ref) || opts.needsHistory() {
+		return clone, nil
+	}
+
+	size, ok := repositorySize(ctx, repoURL, creds)
+	if !ok || size < p.shallowThreshold {
+		return clone, nil
+	}
+
+	clone.Mode = repocache.CloneShallow
+	if len(sparsePaths) > 0 {
+		clone.Mode = repocache.CloneSparse
+		clone.SparsePaths = sparsePaths
+	}
+	log.Printf("%s is %d MB, using a %s clone", repoURL, size>>20, clone.Mode)
+
+	return clone, nil
+}
+
+// repositorySize returns the size of a GitHub repository in bytes, as reported by the
+// GitHub API. It reports false for other hosts and whenever the lookup fails.
+func repositorySize(ctx context.Context, repoURL string, creds *Credentials) (int64, bool) {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil || !strings.EqualFold(endpoint.Host, "github.com") {
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	path := strings.TrimSuffix(strings.Trim(endpoint.Path, "/"), ".git")
+	req, err := http.NewRequestWithContext(ctx, "GET", githubAPI+"/repos/"+path, nil)
+	if err != nil {
+		return 0, false
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if creds != nil && creds.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, false
+	}
+
+	var repo struct {
+		// Size is in kilobytes.
+		Size int64 `json:"size"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&repo); err != nil {
+		return 0, false
+	}
+
+	return repo.Size << 10, true
+}
@@ -0,0 +1,52 @@
+package parser_test
+
+import (
+	"context"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"rankmyrepo/internal/repocache"
+	"testing"
+)
+
+func TestParseRepositorySparseFromFilters(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+
+	newTestRepo(t, repoDir, map[string]string{
+		"backend/main.go": "backend/main.go\n",
+		"frontend/app.ts": "frontend/app.ts\n",
+		"README.md":       "README.md\n",
+	})
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	tests := []struct {
+		name string
+		opts parser.ParseOptions
+	}{
+		{"path prefix", parser.ParseOptions{PathPrefix: "backend"}},
+		{"include patterns", parser.ParseOptions{IncludePatterns: []string{"backend/**/*.go"}}},
+		{"in memory", parser.ParseOptions{PathPrefix: "backend", InMemory: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.CloneMode = repocache.CloneSparse
+			result, err := p.ParseRepository(context.Background(), "file://"+repoDir, tt.opts)
+			if err != nil {
+				t.Fatalf("failed to parse repository: %v", err)
+			}
+			if _, ok := result.Chunks["backend/main.go:1-1"]; !ok || len(result.Chunks) != 1 {
+				t.Errorf("expected only backend/main.go to be parsed, got %v", result.Chunks)
+			}
+		})
+	}
+
+	// Patterns matching at any depth leave no directory to check out.
+	_, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{
+		CloneMode:       repocache.CloneSparse,
+		IncludePatterns: []string{"*.go"},
+	})
+	if err == nil {
+		t.Error("expected a sparse clone without directories to fail")
+	}
+}
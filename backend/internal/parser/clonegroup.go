@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"rankmyrepo/internal/repocache"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// cloneGroup lets concurrent requests for the same repository, ref, clone options and
+// credentials share one temporary clone instead of cloning the repository once each.
+// A clone is removed as soon as the last request using it releases it.
+type cloneGroup struct {
+	tempDir string
+
+	mu     sync.Mutex
+	clones map[string]*sharedClone
+}
+
+type sharedClone struct {
+	ready  chan struct{}
+	dir    string
+	commit string
+	err    error
+
+	// users counts the requests using or waiting for the clone.
+	users  int
+	cancel context.CancelFunc
+}
+
+func newCloneGroup(tempDir string) *cloneGroup {
+	return &cloneGroup{
+		tempDir: tempDir,
+		clones:  make(map[string]*sharedClone),
+	}
+}
+
+// checkout returns a clone of the repository at ref, joining a clone another request
+// started if there is one. The clone runs until it is done or every request waiting
+// for it has given up. release must be called once the clone is no longer used.
+func (g *cloneGroup) checkout(ctx context.Context, repoURL, ref string, auth transport.AuthMethod, opts repocache.CloneOptions, creds *Credentials) (dir, commit string, release func(), err error) {
+	key := cloneKey(repoURL, ref, opts, creds)
+
+	g.mu.Lock()
+	c, ok := g.clones[key]
+	if !ok {
+		cloneCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &sharedClone{ready: make(chan struct{}), cancel: cancel}
+		g.clones[key] = c
+		go g.clone(cloneCtx, key, c, repoURL, ref, auth, opts)
+	}
+	c.users++
+	g.mu.Unlock()
+
+	release = func() { g.release(key, c) }
+
+	select {
+	case <-c.ready:
+	case <-ctx.Done():
+		release()
+		return "", "", nil, ctx.Err()
+	}
+	if c.err != nil {
+		release()
+		return "", "", nil, c.err
+	}
+
+	return c.dir, c.commit, release, nil
+}
+
+func (g *cloneGroup) clone(ctx context.Context, key string, c *sharedClone, repoURL, ref string, auth transport.AuthMethod, opts repocache.CloneOptions) {
+	defer close(c.ready)
+
+	dir, err := os.MkdirTemp(g.tempDir, "clone-*")
+	if err != nil {
+		c.err = err
+	} else {
+		c.dir = dir
+		c.commit, c.err = repocache.Clone(ctx, dir, repoURL, ref, auth, opts)
+	}
+
+	// Failed clones are not shared with requests that arrive later.
+	if c.err != nil {
+		g.mu.Lock()
+		if g.clones[key] == c {
+			delete(g.clones, key)
+		}
+		g.mu.Unlock()
+	}
+}
+
+// release drops a user of the clone. The last user cancels the clone if it is still
+// running and removes its directory.
+func (g *cloneGroup) release(key string, c *sharedClone) {
+	g.mu.Lock()
+	c.users--
+	last := c.users == 0
+	if last && g.clones[key] == c {
+		delete(g.clones, key)
+	}
+	g.mu.Unlock()
+
+	if !last {
+		return
+	}
+
+	c.cancel()
+	<-c.ready
+	if c.dir != "" {
+		if err := os.RemoveAll(c.dir); err != nil {
+			log.Printf("failed to clean up repository directory: %v", err)
+		}
+	}
+}
+
+// cloneKey identifies the clones requests can share. Credentials are part of the key,
+// so a clone of a private repository is only shared with requests that bring the
+// same credentials.
+func cloneKey(repoURL, ref string, opts repocache.CloneOptions, creds *Credentials) string {
+	parts := []string{repoURL, ref, string(opts.Mode), strings.Join(opts.SparsePaths, "\x00")}
+	if creds != nil {
+		parts = append(parts, creds.Username, creds.Token, creds.SSHKey, creds.SSHKeyPassphrase)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00\x00")))
+	return hex.EncodeToString(sum[:])
+}
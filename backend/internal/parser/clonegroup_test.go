@@ -0,0 +1,48 @@
+package parser_test
+
+import (
+	"context"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"sync"
+	"testing"
+)
+
+func TestParseRepositoryConcurrently(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Both repositories are called "repo", so their clones must not share a directory.
+	repos := map[string]string{
+		filepath.Join(tmpDir, "a", "repo"): "a.go",
+		filepath.Join(tmpDir, "b", "repo"): "b.go",
+	}
+	for repoDir, name := range repos {
+		newTestRepo(t, repoDir, map[string]string{name: "package main\n"})
+	}
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	var wg sync.WaitGroup
+	for repoDir, name := range repos {
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				result, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{})
+				if err != nil {
+					t.Errorf("failed to parse %s: %v", repoDir, err)
+					return
+				}
+				for _, chunk := range result.Chunks {
+					if chunk.FilePath != name {
+						t.Errorf("expected only %s in %s, got %s", name, repoDir, chunk.FilePath)
+					}
+				}
+				if len(result.Chunks) == 0 {
+					t.Errorf("expected %s in %s, got no chunks", name, repoDir)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
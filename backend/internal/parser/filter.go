@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	ignore "github.com/sabhiram/go-gitignore"
+)
+
+// fileFilter decides which files of a repository are parsed. A file is parsed when it
+// lies below the path prefix, matches one of the include patterns and languages (if
+// any are given), and matches none of the ignore patterns.
+type fileFilter struct {
+	pathPrefix      string
+	includePatterns []string
+	ignorePatterns  []string
+	languages       map[string]bool
+	// noDefaultIgnores disables the default denylist of repoIgnores.
+	noDefaultIgnores bool
+
+	include *ignore.GitIgnore
+	ignore  *ignore.GitIgnore
+}
+
+func newFileFilter(opts ParseOptions) *fileFilter {
+	// Cleaning the prefix as an absolute path drops any ".." elements.
+	prefix := strings.Trim(path.Clean("/"+filepath.ToSlash(opts.PathPrefix)), "/")
+
+	ignorePatterns := make([]string, len(opts.IgnorePatterns))
+	for i, pattern := range opts.IgnorePatterns {
+		if !strings.HasPrefix(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		ignorePatterns[i] = pattern
+	}
+
+	var languages map[string]bool
+	if len(opts.Languages) > 0 {
+		languages = make(map[string]bool, len(opts.Languages))
+		for _, language := range opts.Languages {
+			languages[strings.ToLower(strings.TrimSpace(language))] = true
+		}
+	}
+
+	f := &fileFilter{
+		pathPrefix:       prefix,
+		includePatterns:  opts.IncludePatterns,
+		ignorePatterns:   ignorePatterns,
+		languages:        languages,
+		noDefaultIgnores: opts.NoDefaultIgnores,
+		ignore:           ignore.CompileIgnoreLines(ignorePatterns...),
+	}
+	if len(opts.IncludePatterns) > 0 {
+		f.include = ignore.CompileIgnoreLines(opts.IncludePatterns...)
+	}
+
+	return f
+}
+
+// key identifies the filter in the names of cached parse results.
+func (f *fileFilter) key() string {
+	languages := make([]string, 0, len(f.languages))
+	for language := range f.languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	return strings.Join([]string{
+		f.pathPrefix,
+		strings.Join(f.includePatterns, "\x00"),
+		strings.Join(f.ignorePatterns, "\x00"),
+		strings.Join(languages, "\x00"),
+		strconv.FormatBool(f.noDefaultIgnores),
+	}, "\x00\x00")
+}
+
+// walkDir reports whether the directory at relPath may contain files below the path
+// prefix.
+func (f *fileFilter) walkDir(relPath string) bool {
+	if f.pathPrefix == "" || relPath == "." {
+		return true
+	}
+	return isWithin(relPath, f.pathPrefix) || strings.HasPrefix(f.pathPrefix, relPath+"/")
+}
+
+// matches reports whether the file at relPath is parsed.
+func (f *fileFilter) matches(relPath string) bool {
+	if f.pathPrefix != "" && !isWithin(relPath, f.pathPrefix) {
+		return false
+	}
+	if f.include != nil && !f.include.MatchesPath(relPath) {
+		return false
+	}
+	if f.languages != nil && !f.languages[DetectLanguage(relPath)] {
+		return false
+	}
+	return !f.ignore.MatchesPath(relPath)
+}
+
+// sparsePaths returns the directories all parsed files lie in, which are all a sparse
+// clone needs to check out: the path prefix, or else the directories the include
+// patterns are anchored in. It returns nil when files anywhere may be parsed.
+func (f *fileFilter) sparsePaths() []string {
+	if f.pathPrefix != "" {
+		return []string{f.pathPrefix}
+	}
+
+	var dirs []string
+	for _, pattern := range f.includePatterns {
+		if strings.HasPrefix(pattern, "!") {
+			// Negated patterns only ever exclude files.
+			continue
+		}
+		dir, ok := patternDir(pattern)
+		if !ok {
+			return nil
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// patternDir returns the directory a gitignore-style pattern is anchored in, e.g.
+// "backend" for "backend/**/*.go". Patterns without a slash before their end match at
+// any depth and have none.
+func patternDir(pattern string) (string, bool) {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		return "", false
+	}
+
+	pattern = strings.TrimPrefix(pattern, "/")
+	literal := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		literal = path.Dir(pattern[:i] + "x")
+	}
+	literal = strings.Trim(path.Clean("/"+literal), "/")
+	return literal, literal != ""
+}
+
+func isWithin(relPath, dir string) bool {
+	return relPath == dir || strings.HasPrefix(relPath, dir+"/")
+}
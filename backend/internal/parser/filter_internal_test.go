@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFileFilterSparsePaths(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ParseOptions
+		want string
+	}{
+		{"no filters", ParseOptions{}, ""},
+		{"path prefix", ParseOptions{PathPrefix: "/backend/internal/"}, "backend/internal"},
+		{"path prefix wins", ParseOptions{PathPrefix: "backend", IncludePatterns: []string{"*.go"}}, "backend"},
+		{"anchored patterns", ParseOptions{IncludePatterns: []string{"backend/**/*.go", "/docs/*.md", "frontend/app/"}}, "backend,docs,frontend/app"},
+		{"literal file", ParseOptions{IncludePatterns: []string{"cmd/server/main.go"}}, "cmd/server/main.go"},
+		{"partial name", ParseOptions{IncludePatterns: []string{"src/parse*"}}, "src"},
+		{"negated patterns are skipped", ParseOptions{IncludePatterns: []string{"src/**", "!src/gen/**"}}, "src"},
+		{"unanchored pattern", ParseOptions{IncludePatterns: []string{"backend/**", "*.go"}}, ""},
+		{"leading wildcard", ParseOptions{IncludePatterns: []string{"**/main.go"}}, ""},
+		{"directory name only", ParseOptions{IncludePatterns: []string{"vendor/"}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(newFileFilter(tt.opts).sparsePaths(), ","); got != tt.want {
+				t.Errorf("expected sparse paths %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
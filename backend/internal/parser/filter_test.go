@@ -0,0 +1,61 @@
+package parser_test
+
+import (
+	"context"
+	"rankmyrepo/internal/parser"
+	"slices"
+	"testing"
+)
+
+func TestParseRepositoryFilters(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"backend/main.go":          "package main\n",
+		"backend/internal/x/x.go":  "package x\n",
+		"backend/internal/x/x.py":  "print('x')\n",
+		"frontend/app/index.ts":    "export {};\n",
+		"frontend/app/README.txt":  "frontend\n",
+		"backend/internal/x/x.txt": "notes\n",
+	})
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	tests := []struct {
+		name string
+		opts parser.ParseOptions
+		want []string
+	}{
+		{
+			name: "include patterns",
+			opts: parser.ParseOptions{IncludePatterns: []string{"backend/**/*.go"}},
+			want: []string{"backend/internal/x/x.go", "backend/main.go"},
+		},
+		{
+			name: "languages",
+			opts: parser.ParseOptions{Languages: []string{"Python", "typescript"}},
+			want: []string{"backend/internal/x/x.py", "frontend/app/index.ts"},
+		},
+		{
+			name: "path prefix",
+			opts: parser.ParseOptions{PathPrefix: "backend/internal/"},
+			want: []string{"backend/internal/x/x.go", "backend/internal/x/x.py", "backend/internal/x/x.txt"},
+		},
+		{
+			name: "combined with ignore patterns",
+			opts: parser.ParseOptions{PathPrefix: "backend", IncludePatterns: []string{"*.go", "*.txt"}, IgnorePatterns: []string{"main.go"}},
+			want: []string{"backend/internal/x/x.go", "backend/internal/x/x.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := p.ParseRepository(context.Background(), tmpDir, tt.opts)
+			if err != nil {
+				t.Fatalf("failed to parse repository: %v", err)
+			}
+
+			if got := parsedFiles(result.Chunks); !slices.Equal(got, tt.want) {
+				t.Errorf("got files %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newTestParser returns a parser for text files that may read local sources below
+// root. It is cleaned up with the test.
+func newTestParser(t *testing.T, root string, opts parser.Options) *parser.Parser {
+	t.Helper()
+
+	opts.LocalRoots = []string{root}
+	p, err := parser.NewParser(map[string]bool{"text/": true}, opts)
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	t.Cleanup(func() { p.Cleanup() })
+	return p
+}
+
+// writeFiles writes files, keyed by slash-separated paths, below dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create test directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+}
+
+// testCommit describes a commit made by commit.
+type testCommit struct {
+	message string
+	// author defaults to "Test" and when to the current time.
+	author string
+	when   time.Time
+	files  map[string]string
+	// submodules are gitlinks to commits of other repositories, keyed by path.
+	submodules map[string]plumbing.Hash
+}
+
+// newTestRepo creates a Git repository in dir with a single commit of files and
+// returns the commit's hash.
+func newTestRepo(t *testing.T, dir string, files map[string]string) plumbing.Hash {
+	t.Helper()
+
+	return commit(t, dir, testCommit{message: "initial commit", files: files})
+}
+
+// commit writes the files of c to the repository in dir, creating the repository if
+// there is none yet, and commits them.
+func commit(t *testing.T, dir string, c testCommit) plumbing.Hash {
+	t.Helper()
+
+	repo, err := git.PlainOpen(dir)
+	if err == git.ErrRepositoryNotExists {
+		repo, err = git.PlainInit(dir, false)
+	}
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to open worktree: %v", err)
+	}
+
+	writeFiles(t, dir, c.files)
+	for name := range c.files {
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatalf("failed to add test file: %v", err)
+		}
+	}
+
+	if len(c.submodules) > 0 {
+		idx, err := repo.Storer.Index()
+		if err != nil {
+			t.Fatalf("failed to read index: %v", err)
+		}
+		for name, hash := range c.submodules {
+			idx.Entries = append(idx.Entries, &index.Entry{Name: name, Hash: hash, Mode: filemode.Submodule})
+		}
+		if err := repo.Storer.SetIndex(idx); err != nil {
+			t.Fatalf("failed to write index: %v", err)
+		}
+	}
+
+	author, when := c.author, c.when
+	if author == "" {
+		author = "Test"
+	}
+	if when.IsZero() {
+		when = time.Now()
+	}
+	hash, err := worktree.Commit(c.message, &git.CommitOptions{
+		Author: &object.Signature{Name: author, Email: "test@example.com", When: when},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	return hash
+}
+
+// parsedFiles returns the sorted paths of the files the chunks belong to.
+func parsedFiles(chunks map[string]parser.ParsedChunk) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, chunk := range chunks {
+		if !seen[chunk.FilePath] {
+			seen[chunk.FilePath] = true
+			files = append(files, chunk.FilePath)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,376 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// maxHistoryCommits bounds how many recent commits a parse may add as chunks.
+const maxHistoryCommits = 100
+
+// historyDir is the directory the chunks of commits and their diffs are placed in.
+// Git never stores a .git entry in a tree, so these paths cannot clash with files of
+// the repository.
+const historyDir = ".git/commits"
+
+// errShallowClone rejects history and reviews for shallow clones, which only know the
+// commit they were cloned at.
+var errShallowClone = errors.New("history and reviews are not available for shallow clones, use a full clone instead")
+
+// HistoryOptions add the Git history of a repository to a parse, so questions about who
+// changed what and why can be answered.
+type HistoryOptions struct {
+	// Blame sets the LastCommit of each chunk to the most recent commit that changed
+	// one of its lines.
+	Blame bool
+	// Commits adds a chunk with the message of each of this many most recent commits.
+	Commits int
+	// Diffs adds the changes of those commits as chunks, one per changed file.
+	Diffs bool
+}
+
+func (o HistoryOptions) enabled() bool {
+	return o.Blame || o.Commits > 0
+}
+
+func (o HistoryOptions) validate() error {
+	if o.Commits < 0 || o.Commits > maxHistoryCommits {
+		return fmt.Errorf("history commits must be between 0 and %d", maxHistoryCommits)
+	}
+	if o.Diffs && o.Commits == 0 {
+		return errors.New("history diffs need a number of commits")
+	}
+	return nil
+}
+
+// CommitInfo describes a commit of the repository's history.
+type CommitInfo struct {
+	Hash    string
+	Author  string
+	Date    time.Time
+	Message string
+}
+
+func newCommitInfo(commit *object.Commit) *CommitInfo {
+	return &CommitInfo{
+		Hash:    commit.Hash.String(),
+		Author:  fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email),
+		Date:    commit.Author.When,
+		Message: strings.TrimSpace(commit.Message),
+	}
+}
+
+// String summarizes the commit in one line, e.g. for prompts.
+func (c *CommitInfo) String() string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return fmt.Sprintf("%.12s by %s on %s: %s", c.Hash, c.Author, c.Date.Format(time.DateOnly), subject)
+}
+
+// history reads the history of a parsed revision.
+type history struct {
+	parser *Parser
+	ws     *workspace
+	repo   *git.Repository
+	head   *object.Commit
+	opts   HistoryOptions
+
+	commits map[plumbing.Hash]*CommitInfo
+	// blamed is the file the lines were blamed for; chunks arrive one file at a time.
+	blamed  string
+	lines   []*git.Line
+	blameOK bool
+	// blamedFiles and blamedBytes count the files blamed so far against the limits.
+	blamedFiles int
+	blamedBytes int64
+}
+
+// newHistory returns the history of the workspace, or nil if the request did not ask
+// for it.
+func (p *Parser) newHistory(ws *workspace, opts HistoryOptions) (*history, error) {
+	if !opts.enabled() {
+		return nil, nil
+	}
+	if err := fullHistory(ws); err != nil {
+		return nil, err
+	}
+
+	head, err := ws.repo.CommitObject(plumbing.NewHash(ws.revision.Commit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", ws.revision.Commit, err)
+	}
+
+	return &history{
+		parser:  p,
+		ws:      ws,
+		repo:    ws.repo,
+		head:    head,
+		opts:    opts,
+		commits: make(map[plumbing.Hash]*CommitInfo),
+	}, nil
+}
+
+// fullHistory checks that the workspace has the full history of its repository.
+func fullHistory(ws *workspace) error {
+	if ws.repo == nil {
+		return errors.New("history and reviews are only available for Git repositories")
+	}
+
+	// History and reviews ask for full clones, which deepen shallow cache entries, so
+	// this only rejects clones whose history could not be completed.
+	shallow, err := ws.repo.Storer.Shallow()
+	if err != nil {
+		return fmt.Errorf("failed to read shallow commits: %w", err)
+	}
+	if len(shallow) > 0 {
+		return errShallowClone
+	}
+	return nil
+}
+
+// annotate sets the LastCommit of the chunks sent to out. Files whose history cannot be
+// read are reported as warnings and files beyond the blame limits as skipped; their
+// chunks are sent without it, like the files of submodules, whose history is not part
+// of the repository.
+func (h *history) annotate(out sink) sink {
+	if h == nil || !h.opts.Blame {
+		return out
+	}
+
+	chunk := out.chunk
+	out.chunk = func(c ParsedChunk) error {
+		if h.ws.inSubmodule(c.FilePath) {
+			return chunk(c)
+		}
+		if c.FilePath != h.blamed {
+			h.blamed = c.FilePath
+			reason, err := h.blame(c.FilePath)
+			if err != nil {
+				log.Printf("failed to blame %s: %v", c.FilePath, err)
+				if err := out.warning(ParseWarning{Path: c.FilePath, Message: "failed to read history: " + warningMessage(err)}); err != nil {
+					return err
+				}
+			}
+			if reason != "" {
+				if err := out.skipped(SkippedFile{Path: c.FilePath, Reason: reason}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if h.blameOK {
+			commit, err := h.lastCommit(c.StartLine, c.EndLine)
+			if err != nil {
+				return err
+			}
+			c.LastCommit = commit
+		}
+		return chunk(c)
+	}
+	return out
+}
+
+// blame reads the last commit of every line of the file. If that would exceed the blame
+// limits, the file is left unblamed and the reason is returned.
+func (h *history) blame(filePath string) (string, error) {
+	h.lines, h.blameOK = nil, false
+
+	limits := h.parser.limits
+	if limits.MaxBlameFiles > 0 && h.blamedFiles >= limits.MaxBlameFiles {
+		return fmt.Sprintf("history was read for %d files, the history of this file was skipped", limits.MaxBlameFiles), nil
+	}
+	if limits.MaxBlameBytes > 0 {
+		file, err := h.head.File(filePath)
+		if err != nil {
+			return "", err
+		}
+		if h.blamedBytes+file.Size > limits.MaxBlameBytes {
+			return fmt.Sprintf("history was read for %d bytes, the history of this file was skipped", limits.MaxBlameBytes), nil
+		}
+		h.blamedBytes += file.Size
+	}
+	h.blamedFiles++
+
+	result, err := git.Blame(h.head, filePath)
+	if err != nil {
+		return "", err
+	}
+	h.lines, h.blameOK = result.Lines, true
+	return "", nil
+}
+
+// lastCommit returns the most recent commit among the blamed lines start to end.
+func (h *history) lastCommit(start, end int) (*CommitInfo, error) {
+	var latest *git.Line
+	for _, line := range h.lines[max(start-1, 0):min(end, len(h.lines))] {
+		if latest == nil || line.Date.After(latest.Date) {
+			latest = line
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	return h.commit(latest.Hash)
+}
+
+func (h *history) commit(hash plumbing.Hash) (*CommitInfo, error) {
+	if info, ok := h.commits[hash]; ok {
+		return info, nil
+	}
+
+	commit, err := h.repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+	info := newCommitInfo(commit)
+	h.commits[hash] = info
+	return info, nil
+}
+
+// recentCommits sends a chunk for each of the most recent commits and, if requested,
+// chunks with their changes to the files that pass the filter.
+func (h *history) recentCommits(fsys fs.FS, filter *fileFilter, out sink) error {
+	if h == nil || h.opts.Commits == 0 {
+		return nil
+	}
+
+	iter, err := h.repo.Log(&git.LogOptions{From: h.head.Hash, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	defer iter.Close()
+
+	for range h.opts.Commits {
+		commit, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read history: %w", err)
+		}
+
+		info := newCommitInfo(commit)
+		h.commits[commit.Hash] = info
+
+		content := commitMessage(info)
+		if err := out.chunk(historyChunk(path.Join(historyDir, commit.Hash.String()[:12]), "commit", content, info)); err != nil {
+			return err
+		}
+
+		if h.opts.Diffs {
+			if err := h.diffs(commit, info, fsys, filter, out); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// diffs sends the changes the commit made to each file as chunks. Binary files are
+// left out and diffs larger than the file size limit are reported as skipped.
+func (h *history) diffs(commit *object.Commit, info *CommitInfo, fsys fs.FS, filter *fileFilter, out sink) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree of %s: %w", commit.Hash, err)
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return fmt.Errorf("failed to read parent of %s: %w", commit.Hash, err)
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return fmt.Errorf("failed to read tree of %s: %w", parent.Hash, err)
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return fmt.Errorf("failed to diff %s: %w", commit.Hash, err)
+	}
+
+	limits := h.parser.limits
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		if !filter.matches(name) || ignoredAt(fsys, name, !filter.noDefaultIgnores) {
+			continue
+		}
+
+		patch, err := change.Patch()
+		if err != nil {
+			return fmt.Errorf("failed to diff %s in %s: %w", name, commit.Hash, err)
+		}
+		if binaryPatch(patch) {
+			continue
+		}
+
+		diffPath := path.Join(historyDir, commit.Hash.String()[:12], name+".diff")
+		content := patch.String()
+		if limits.MaxFileBytes > 0 && int64(len(content)) > limits.MaxFileBytes {
+			if err := out.skipped(SkippedFile{
+				Path:   diffPath,
+				Reason: fmt.Sprintf("diff is larger than %d bytes", limits.MaxFileBytes),
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, segment := range h.parser.chunker.Split(diffPath, []byte(content)) {
+			chunk := historyChunk(diffPath, "diff", segment.Content, info)
+			chunk.StartLine, chunk.EndLine = segment.StartLine, segment.EndLine
+			chunk.StartByte, chunk.EndByte = segment.StartByte, segment.EndByte
+			if err := out.chunk(chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// historyChunk returns a chunk of a commit that covers all of content.
+func historyChunk(filePath, language, content string, info *CommitInfo) ParsedChunk {
+	return ParsedChunk{
+		ID:         chunkID(filePath, content),
+		FilePath:   filePath,
+		Content:    content,
+		Language:   language,
+		StartLine:  1,
+		EndLine:    strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1,
+		EndByte:    len(content),
+		LastCommit: info,
+	}
+}
+
+// commitMessage formats the commit like git log does.
+func commitMessage(info *CommitInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "commit %s\nAuthor: %s\nDate:   %s\n\n", info.Hash, info.Author, info.Date.Format(time.RFC1123Z))
+	for _, line := range strings.Split(info.Message, "\n") {
+		b.WriteString("    " + line + "\n")
+	}
+	return b.String()
+}
+
+func binaryPatch(patch *object.Patch) bool {
+	for _, filePatch := range patch.FilePatches() {
+		if filePatch.IsBinary() {
+			return true
+		}
+	}
+	return false
+}
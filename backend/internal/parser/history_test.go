@@ -0,0 +1,159 @@
+package parser_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"rankmyrepo/internal/repocache"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRepositoryHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+
+	commits := []testCommit{
+		{author: "Alice", message: "Add retry", files: map[string]string{"main.go": "package main\n\nfunc retries() int {\n\treturn 1\n}\n"}},
+		{author: "Bob", message: "Retry three times\n\nThe server is flaky.", files: map[string]string{"main.go": "package main\n\nfunc retries() int {\n\treturn 3\n}\n"}},
+	}
+	when := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, c := range commits {
+		c.when = when.AddDate(0, i, 0)
+		commit(t, repoDir, c)
+	}
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	result, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{
+		History: parser.HistoryOptions{Blame: true, Commits: 1, Diffs: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+
+	var languages []string
+	for _, chunk := range result.Chunks {
+		languages = append(languages, chunk.Language)
+		if chunk.LastCommit == nil {
+			t.Errorf("expected %s to have a last commit", chunk.Location())
+			continue
+		}
+		if chunk.LastCommit.Author != "Bob <test@example.com>" || chunk.LastCommit.Message != "Retry three times\n\nThe server is flaky." {
+			t.Errorf("expected %s to be last changed by Bob, got %s", chunk.Location(), chunk.LastCommit)
+		}
+		if chunk.Language == "diff" && !strings.Contains(chunk.Content, "+\treturn 3") {
+			t.Errorf("expected the diff to contain the change, got %q", chunk.Content)
+		}
+	}
+	sort.Strings(languages)
+	if strings.Join(languages, ",") != "commit,diff,go" {
+		t.Errorf("expected a file, a commit and a diff chunk, got %v", languages)
+	}
+
+	_, err = p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{
+		CloneMode: repocache.CloneShallow,
+		History:   parser.HistoryOptions{Blame: true},
+	})
+	if err == nil {
+		t.Error("expected history of a shallow clone to fail")
+	}
+}
+
+func TestParseRepositoryBlameLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	newTestRepo(t, repoDir, map[string]string{
+		"a.go": "package a\n",
+		"b.go": "package b\n",
+		"c.go": strings.Repeat("// too large to blame\n", 10),
+	})
+
+	tests := []struct {
+		name    string
+		limits  parser.Limits
+		blamed  []string
+		skipped []string
+	}{
+		{"files", parser.Limits{MaxBlameFiles: 1}, []string{"a.go"}, []string{"b.go", "c.go"}},
+		{"bytes", parser.Limits{MaxBlameBytes: 100}, []string{"a.go", "b.go"}, []string{"c.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestParser(t, tmpDir, parser.Options{Limits: tt.limits})
+
+			result, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{
+				History: parser.HistoryOptions{Blame: true},
+			})
+			if err != nil {
+				t.Fatalf("failed to parse repository: %v", err)
+			}
+
+			var blamed []string
+			for _, chunk := range result.Chunks {
+				if chunk.LastCommit != nil {
+					blamed = append(blamed, chunk.FilePath)
+				}
+			}
+			sort.Strings(blamed)
+			if strings.Join(blamed, ",") != strings.Join(tt.blamed, ",") {
+				t.Errorf("expected %v to be blamed, got %v", tt.blamed, blamed)
+			}
+
+			var skipped []string
+			for _, file := range result.Skipped {
+				skipped = append(skipped, file.Path)
+			}
+			if strings.Join(skipped, ",") != strings.Join(tt.skipped, ",") {
+				t.Errorf("expected %v to be skipped, got %+v", tt.skipped, result.Skipped)
+			}
+			if files := parsedFiles(result.Chunks); len(files) != 3 {
+				t.Errorf("expected every file to be parsed, got %v", files)
+			}
+		})
+	}
+}
+
+func TestParseRepositoryHistoryDeepensCachedClones(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	for i, author := range []string{"Alice", "Bob"} {
+		commit(t, repoDir, testCommit{
+			message: "Change main",
+			author:  author,
+			when:    time.Date(2024, time.Month(1+i), 1, 0, 0, 0, 0, time.UTC),
+			files:   map[string]string{"main.go": fmt.Sprintf("package main // %d\n", i)},
+		})
+	}
+
+	cache, err := repocache.NewCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	p := newTestParser(t, tmpDir, parser.Options{Cache: cache})
+
+	// The first request leaves a shallow clone in the cache.
+	if _, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{CloneMode: repocache.CloneShallow}); err != nil {
+		t.Fatalf("failed to parse shallow clone: %v", err)
+	}
+
+	result, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{
+		History: parser.HistoryOptions{Commits: 2},
+	})
+	if err != nil {
+		t.Fatalf("failed to parse history of the cached clone: %v", err)
+	}
+
+	var commits int
+	for _, chunk := range result.Chunks {
+		if chunk.Language == "commit" {
+			commits++
+		}
+	}
+	if commits != 2 {
+		t.Errorf("expected both commits in the history, got %d", commits)
+	}
+}
@@ -0,0 +1,193 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// projectIgnoreFile lists files a repository wants to keep out of answers without
+// ignoring them in Git. It uses the .gitignore syntax.
+const projectIgnoreFile = ".askmyrepoignore"
+
+// defaultDenylist keeps dependencies, build output and lockfiles out of the parse.
+// Requests can opt out of it.
+var defaultDenylist = []string{
+	"node_modules/",
+	"bower_components/",
+	"vendor/",
+	"third_party/",
+	"dist/",
+	"__pycache__/",
+	".venv/",
+	"*.min.js",
+	"*.min.css",
+	"*.map",
+	"package-lock.json",
+	"npm-shrinkwrap.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"bun.lockb",
+	"go.sum",
+	"Cargo.lock",
+	"Gemfile.lock",
+	"composer.lock",
+	"poetry.lock",
+	"Pipfile.lock",
+	"uv.lock",
+	"mix.lock",
+	"Package.resolved",
+}
+
+// repoIgnores collects the rules a repository declares for itself while its
+// directories are walked: nested .gitignore and .askmyrepoignore files, and files
+// marked linguist-generated or linguist-vendored in .gitattributes.
+type repoIgnores struct {
+	patterns   []gitignore.Pattern
+	attributes []gitattributes.MatchAttribute
+	defaults   gitignore.Matcher
+	// unmarked is set once any file is explicitly marked as not generated or not
+	// vendored, which may bring files in denylisted directories back.
+	unmarked bool
+}
+
+func newRepoIgnores(useDefaults bool) *repoIgnores {
+	r := &repoIgnores{}
+	if useDefaults {
+		patterns := make([]gitignore.Pattern, len(defaultDenylist))
+		for i, pattern := range defaultDenylist {
+			patterns[i] = gitignore.ParsePattern(pattern, nil)
+		}
+		r.defaults = gitignore.NewMatcher(patterns)
+	}
+	return r
+}
+
+// enterDir reads the ignore files of the directory at relPath. Directories are walked
+// depth first, so the rules of a directory are known before any of its files are
+// matched; rules only ever apply below the directory that declares them.
+func (r *repoIgnores) enterDir(fsys fs.FS, relPath string) {
+	domain := pathParts(relPath)
+
+	for _, name := range []string{".gitignore", projectIgnoreFile} {
+		data, ok := readIgnoreFile(fsys, path.Join(relPath, name))
+		if !ok {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			r.patterns = append(r.patterns, gitignore.ParsePattern(line, domain))
+		}
+	}
+
+	if data, ok := readIgnoreFile(fsys, path.Join(relPath, ".gitattributes")); ok {
+		attributes, err := gitattributes.ReadAttributes(bytes.NewReader(data), domain, relPath == ".")
+		if err != nil {
+			log.Printf("ignoring invalid .gitattributes in %s: %v", relPath, err)
+			return
+		}
+		for _, attribute := range attributes {
+			for _, attr := range attribute.Attributes {
+				if isLinguistExclusion(attr.Name()) && (attr.IsUnset() || attr.IsValueSet() && attr.Value() == "false") {
+					r.unmarked = true
+				}
+			}
+		}
+		r.attributes = append(r.attributes, attributes...)
+	}
+}
+
+// ignored reports whether the repository or the default denylist excludes the path.
+// Files explicitly marked as not generated or not vendored are kept even if the
+// denylist matches them.
+func (r *repoIgnores) ignored(relPath string, isDir bool) bool {
+	parts := pathParts(relPath)
+
+	if gitignore.NewMatcher(r.patterns).Match(parts, isDir) {
+		return true
+	}
+
+	if !isDir && len(r.attributes) > 0 {
+		matcher := gitattributes.NewMatcher(r.attributes)
+		explicit := false
+		for _, name := range linguistExclusions {
+			// Attributes are matched one at a time, as the matcher only gives the last
+			// matching rule precedence for all requested attributes together.
+			attrs, _ := matcher.Match(parts, []string{name})
+			attr, ok := attrs[name]
+			if !ok {
+				continue
+			}
+			if attr.IsSet() || attr.IsValueSet() && attr.Value() == "true" {
+				return true
+			}
+			explicit = true
+		}
+		if explicit {
+			return false
+		}
+	}
+
+	if isDir && r.unmarked {
+		return false
+	}
+	return r.defaults != nil && r.defaults.Match(parts, isDir)
+}
+
+// ignoredAt reports whether the ignore rules of the repository at its current revision,
+// or the default denylist, exclude the file at relPath.
+func ignoredAt(fsys fs.FS, relPath string, useDefaults bool) bool {
+	ignores := newRepoIgnores(useDefaults)
+
+	dir := "."
+	ignores.enterDir(fsys, dir)
+	for _, part := range pathParts(path.Dir(relPath)) {
+		dir = path.Join(dir, part)
+		if ignores.ignored(dir, true) {
+			return true
+		}
+		ignores.enterDir(fsys, dir)
+	}
+
+	return ignores.ignored(relPath, false)
+}
+
+// linguistExclusions are the .gitattributes attributes GitHub uses to leave files
+// out of language statistics, which also keep them out of the parse.
+var linguistExclusions = []string{"linguist-generated", "linguist-vendored"}
+
+func isLinguistExclusion(name string) bool {
+	for _, exclusion := range linguistExclusions {
+		if name == exclusion {
+			return true
+		}
+	}
+	return false
+}
+
+func readIgnoreFile(fsys fs.FS, name string) ([]byte, bool) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("failed to read %s: %v", name, err)
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+func pathParts(relPath string) []string {
+	if relPath == "." {
+		return nil
+	}
+	return strings.Split(relPath, "/")
+}
@@ -0,0 +1,65 @@
+package parser_test
+
+import (
+	"context"
+	"rankmyrepo/internal/parser"
+	"slices"
+	"testing"
+)
+
+func TestParseRepositoryHonoursRepoIgnores(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		".gitignore":                "*.log\nbuild/\n",
+		".askmyrepoignore":          "docs/\n",
+		".gitattributes":            "gen/*.go linguist-generated\nvendor/keep/** -linguist-vendored\n",
+		".git/config":               "[core]\n",
+		"main.go":                   "package main\n",
+		"secret.txt":                "not ignored at the root\n",
+		"app.log":                   "log\n",
+		"build/out.txt":             "out\n",
+		"sub/.gitignore":            "secret.txt\n",
+		"sub/secret.txt":            "secret\n",
+		"docs/guide.txt":            "guide\n",
+		"gen/models.go":             "package gen\n",
+		"node_modules/pkg/index.js": "module.exports = {};\n",
+		"package-lock.json":         "{}\n",
+		"vendor/lib/lib.go":         "package lib\n",
+		"vendor/keep/keep.go":       "package keep\n",
+	})
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	ignoreFiles := []string{".gitignore", ".askmyrepoignore", ".gitattributes", "sub/.gitignore"}
+
+	tests := []struct {
+		name string
+		opts parser.ParseOptions
+		want []string
+	}{
+		{
+			name: "default denylist",
+			opts: parser.ParseOptions{},
+			want: append([]string{"main.go", "secret.txt", "vendor/keep/keep.go"}, ignoreFiles...),
+		},
+		{
+			name: "without default denylist",
+			opts: parser.ParseOptions{NoDefaultIgnores: true},
+			want: append([]string{"main.go", "secret.txt", "vendor/keep/keep.go", "vendor/lib/lib.go", "node_modules/pkg/index.js", "package-lock.json"}, ignoreFiles...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := p.ParseRepository(context.Background(), tmpDir, tt.opts)
+			if err != nil {
+				t.Fatalf("failed to parse repository: %v", err)
+			}
+
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if got := parsedFiles(result.Chunks); !slices.Equal(got, want) {
+				t.Errorf("got files %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+var languagesByExtension = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".cs":    "csharp",
+	".rb":    "ruby",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".swift": "swift",
+	".php":   "php",
+	".scala": "scala",
+	".sh":    "shell",
+	".bash":  "shell",
+	".sql":   "sql",
+	".html":  "html",
+	".css":   "css",
+	".scss":  "scss",
+	".md":    "markdown",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".xml":   "xml",
+	".proto": "protobuf",
+}
+
+var languagesByFilename = map[string]string{
+	"dockerfile": "dockerfile",
+	"makefile":   "makefile",
+}
+
+// DetectLanguage guesses the language of a file from its name. It returns an empty
+// string when the language is unknown.
+func DetectLanguage(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+	if lang, ok := languagesByFilename[base]; ok {
+		return lang
+	}
+	return languagesByExtension[strings.ToLower(filepath.Ext(base))]
+}
@@ -2,23 +2,117 @@ package parser
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
+	"rankmyrepo/internal/repocache"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
-	ignore "github.com/sabhiram/go-gitignore"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
+// chunkCacheVersion is part of the key parse results are cached under. Bump it whenever
+// a change to the parser or chunker alters the chunks produced for the same commit.
+const chunkCacheVersion = 4
+
 type Parser struct {
 	tempDir       string
 	textMimeTypes map[string]bool
+	chunker       *Chunker
+	cache         *repocache.Cache
+	credentials   *CredentialStore
+	clones        *cloneGroup
+
+	shallowThreshold int64
+	localRoots       []string
+	limits           Limits
+}
+
+type Options struct {
+	// Cache keeps clones and parse results between requests. Without a cache every
+	// request clones into a temporary directory.
+	Cache *repocache.Cache
+	// Credentials are used for repositories the request brings no credentials for.
+	Credentials *CredentialStore
+	// ShallowThreshold is the repository size in bytes from which repositories are
+	// cloned shallowly unless the request asks for a clone mode. Only sizes of GitHub
+	// repositories are known; zero disables shallow clones by default.
+	ShallowThreshold int64
+	// LocalRoots are the directories local paths and file:// URLs may point into.
+	// Local sources are rejected when empty.
+	LocalRoots []string
+	Limits     Limits
+}
+
+// Limits bound the memory a single parse may use. Zero values mean no limit.
+type Limits struct {
+	// MaxFileBytes skips files larger than this.
+	MaxFileBytes int64
+	// MaxFiles and MaxTotalBytes stop the parse once this many files or bytes have
+	// been read.
+	MaxFiles      int
+	MaxTotalBytes int64
+	// MaxBlameFiles and MaxBlameBytes bound how many files and bytes history blame
+	// reads, since it walks the whole history of every file. Files beyond them are
+	// parsed without their last commits and reported as skipped.
+	MaxBlameFiles int
+	MaxBlameBytes int64
+}
+
+// ParseOptions are the per-request settings of ParseRepository.
+type ParseOptions struct {
+	// Ref is the branch, tag or commit SHA to parse. It defaults to the default branch.
+	Ref            string
+	IgnorePatterns []string
+	// IncludePatterns are gitignore-style patterns such as "backend/**/*.go". When
+	// set, only matching files are parsed.
+	IncludePatterns []string
+	// Languages restricts parsing to files of these languages, e.g. "go" or "python".
+	Languages []string
+	// PathPrefix restricts parsing to the files below this directory.
+	PathPrefix string
+	// NoDefaultIgnores parses dependencies, build output and lockfiles that are left
+	// out by default. The repository's own ignore files are honored regardless.
+	NoDefaultIgnores bool
+	// CloneMode forces a clone mode. It is chosen based on the repository size when
+	// empty.
+	CloneMode repocache.CloneMode
+	// SparsePaths limits the checkout, and with it the parsed files, to these
+	// directories. Sparse clones default to the path prefix or the directories the
+	// include patterns are anchored in, so they rarely need to be given.
+	SparsePaths []string
+	// Credentials authenticate the clone of a private repository. When nil, credentials
+	// embedded in the URL or configured on the server are used.
+	Credentials *Credentials
+	// InMemory clones Git URLs into memory and reads the files of the commit straight
+	// from the object storage instead of checking them out. Such clones bypass the
+	// repository cache.
+	InMemory bool
+	// History adds the commits that last changed each chunk and recent commits with
+	// their changes to the parse. It needs the full history of the repository.
+	History HistoryOptions
+	// SubmoduleDepth clones the submodules of Git URLs, and their submodules up to this
+	// many levels deep, and parses their files at their paths. Zero leaves submodules
+	// out. Local directories are parsed as they are on disk either way.
+	SubmoduleDepth int
+	// BaseRef turns the parse into a review of the change from BaseRef to Ref: the
+	// hunks of the change are sent as chunks before the files of Ref. Like the history,
+	// it needs the full history of the repository.
+	BaseRef string
+}
+
+// needsHistory reports whether the parse reads more of the repository's history than
+// the commit it parses.
+func (o ParseOptions) needsHistory() bool {
+	return o.History.enabled() || o.BaseRef != ""
 }
 
-func NewParser(textMimeTypes map[string]bool) (*Parser, error) {
+func NewParser(textMimeTypes map[string]bool, opts Options) (*Parser, error) {
 	tempDir, err := os.MkdirTemp("", "repo-parser-*")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp directory: %w", err)
@@ -27,89 +121,505 @@ func NewParser(textMimeTypes map[string]bool) (*Parser, error) {
 	return &Parser{
 		tempDir:       tempDir,
 		textMimeTypes: textMimeTypes,
+		chunker:       NewChunker(20, 120),
+		cache:         opts.Cache,
+		credentials:   opts.Credentials,
+		clones:        newCloneGroup(tempDir),
+
+		shallowThreshold: opts.ShallowThreshold,
+		localRoots:       opts.LocalRoots,
+		limits:           opts.Limits,
 	}, nil
 }
 
-// ParseRepository parses the repository at the given URL and returns a map of RawChunk
-// with the file paths as keys and the content as values.
+// RegisterSplitter plugs a language specific splitter into the parser's chunker.
+func (p *Parser) RegisterSplitter(ext string, splitter Splitter) {
+	p.chunker.Register(ext, splitter)
+}
+
+// ParseRepository parses the repository at the given URL and returns a map of ParsedChunk.
+// Besides the request's filters, the repository's .gitignore, .askmyrepoignore and
+// .gitattributes files and a default denylist decide which files are parsed. Files are
+// split into functions, methods, types and classes where a splitter is known
+// for the language, and into line windows otherwise. Chunks are keyed by file path and
+// line range, e.g. "cmd/server/main.go:12-40". The result also reports the commit the
+// requested ref resolved to.
+//
+// Private repositories are cloned over HTTPS with a token or over SSH with a private key.
+// Errors never contain the credentials.
+//
+// Local paths are parsed as they are on disk, including uncommitted changes, while
+// file:// URLs are cloned like any other Git URL. Both must lie below one of the
+// configured local roots.
+func (p *Parser) ParseRepository(ctx context.Context, repoURL string, opts ParseOptions) (*ParseResult, error) {
+	src, err := p.repositorySource(repoURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.collect(ctx, src, opts)
+}
 
-// NOTE: This currently only supports Public GitHub repositories.
+// ParseRepositoryStream parses like ParseRepository, but sends the chunks to chunkChan
+// as the files are read, so callers can work on the first files while the rest of the
+// tree is still being walked. The revision is sent to revisionChan once the repository
+// is checked out, and skipped files and warnings are sent to skippedChan and
+// warningChan as they are found. None of the channels are closed.
+func (p *Parser) ParseRepositoryStream(ctx context.Context, repoURL string, opts ParseOptions, revisionChan chan<- Revision, chunkChan chan<- ParsedChunk, skippedChan chan<- SkippedFile, warningChan chan<- ParseWarning) error {
+	src, err := p.repositorySource(repoURL, opts)
+	if err != nil {
+		return err
+	}
 
-func (p *Parser) ParseRepository(ctx context.Context, repoURL string, ignorePatterns []string) (map[string]ParsedChunk, error) {
-	repoDir := filepath.Join(p.tempDir, filepath.Base(repoURL))
+	return p.parse(ctx, src, opts, channelSink(ctx, revisionChan, chunkChan, skippedChan, warningChan))
+}
 
-	_, err := git.PlainCloneContext(ctx, repoDir, false, &git.CloneOptions{
-		URL:      repoURL,
-		Progress: os.Stdout,
+func (p *Parser) repositorySource(repoURL string, opts ParseOptions) (source, error) {
+	if err := opts.History.validate(); err != nil {
+		return nil, err
+	}
+	if opts.SubmoduleDepth < 0 || opts.SubmoduleDepth > maxSubmoduleDepth {
+		return nil, fmt.Errorf("submodule depth must be between 0 and %d", maxSubmoduleDepth)
+	}
+
+	repoURL, urlCredentials := splitURLCredentials(repoURL)
+
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	if endpoint.Protocol == "file" {
+		dir, err := p.localPath(endpoint.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(repoURL, "file://") {
+			return &localSource{dir: dir, path: repoURL, ref: opts.Ref, history: opts.needsHistory()}, nil
+		}
+	}
+
+	return &gitSource{
+		parser:         p,
+		url:            repoURL,
+		urlCredentials: urlCredentials,
+		opts:           opts,
+	}, nil
+}
+
+// ParseArchive parses the files of a .zip, .tar.gz or .tar archive. name is the
+// original file name of the archive, which determines its format.
+func (p *Parser) ParseArchive(ctx context.Context, archivePath, name string, opts ParseOptions) (*ParseResult, error) {
+	src, err := p.archiveSource(archivePath, name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.collect(ctx, src, opts)
+}
+
+// ParseArchiveStream parses like ParseArchive and reports its results like
+// ParseRepositoryStream.
+func (p *Parser) ParseArchiveStream(ctx context.Context, archivePath, name string, opts ParseOptions, revisionChan chan<- Revision, chunkChan chan<- ParsedChunk, skippedChan chan<- SkippedFile, warningChan chan<- ParseWarning) error {
+	src, err := p.archiveSource(archivePath, name, opts)
+	if err != nil {
+		return err
+	}
+
+	return p.parse(ctx, src, opts, channelSink(ctx, revisionChan, chunkChan, skippedChan, warningChan))
+}
+
+func (p *Parser) archiveSource(archivePath, name string, opts ParseOptions) (source, error) {
+	if opts.Ref != "" {
+		return nil, fmt.Errorf("refs are not supported for archives")
+	}
+	if opts.needsHistory() {
+		return nil, fmt.Errorf("history and reviews are not supported for archives")
+	}
+
+	return &archiveSource{
+		tempDir: p.tempDir,
+		path:    archivePath,
+		name:    name,
+	}, nil
+}
+
+// sink receives the results of a parse as they become available: first the revision,
+// then the chunks, skipped files and warnings in walk order. An error stops the parse.
+type sink struct {
+	revision func(Revision) error
+	chunk    func(ParsedChunk) error
+	skipped  func(SkippedFile) error
+	warning  func(ParseWarning) error
+}
+
+// channelSink sends the results of a parse to the channels until ctx is done. Nil
+// channels are ignored.
+func channelSink(ctx context.Context, revisionChan chan<- Revision, chunkChan chan<- ParsedChunk, skippedChan chan<- SkippedFile, warningChan chan<- ParseWarning) sink {
+	return sink{
+		revision: func(revision Revision) error { return send(ctx, revisionChan, revision) },
+		chunk:    func(chunk ParsedChunk) error { return send(ctx, chunkChan, chunk) },
+		skipped:  func(file SkippedFile) error { return send(ctx, skippedChan, file) },
+		warning:  func(warning ParseWarning) error { return send(ctx, warningChan, warning) },
+	}
+}
+
+func send[T any](ctx context.Context, ch chan<- T, v T) error {
+	if ch == nil {
+		return nil
+	}
+
+	select {
+	case ch <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// collect parses the files of the source into a ParseResult.
+func (p *Parser) collect(ctx context.Context, src source, opts ParseOptions) (*ParseResult, error) {
+	result := &ParseResult{
+		Chunks: make(map[string]ParsedChunk),
+	}
+
+	err := p.parse(ctx, src, opts, sink{
+		revision: func(revision Revision) error {
+			result.Revision = revision
+			return nil
+		},
+		chunk: func(chunk ParsedChunk) error {
+			result.Chunks[chunk.Location()] = chunk
+			return nil
+		},
+		skipped: func(file SkippedFile) error {
+			result.Skipped = append(result.Skipped, file)
+			return nil
+		},
+		warning: func(warning ParseWarning) error {
+			result.Warnings = append(result.Warnings, warning)
+			return nil
+		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to clone repository: %w", err)
+		return nil, err
 	}
 
-	defer func() {
-		if err := os.RemoveAll(repoDir); err != nil {
-			fmt.Printf("warning: failed to clean up repository directory: %v\n", err)
+	return result, nil
+}
+
+// parse parses the files of the source, reporting the results to out. Parse results
+// of cached clones are reused as long as neither the commit nor the file filters,
+// sparse paths, history options, review base or submodule depth have changed; they are
+// replayed to out at once.
+//
+// A source whose files cannot be walked at all fails with a *WalkError before the
+// revision is reported.
+func (p *Parser) parse(ctx context.Context, src source, opts ParseOptions, out sink) error {
+	ws, err := src.open(ctx)
+	if err != nil {
+		return err
+	}
+	// Mounting submodules extends release.
+	defer func() { ws.release() }()
+
+	filter := newFileFilter(opts)
+
+	review, err := p.newReview(ws, opts.BaseRef)
+	if err != nil {
+		return err
+	}
+	history, err := p.newHistory(ws, opts.History)
+	if err != nil {
+		return err
+	}
+	// walk sends the hunks under review first, then parses the files including those of
+	// submodules, followed by the recent commits, for whichever of these were asked for.
+	walk := func(out sink) error {
+		if ws.mount != nil {
+			if err := ws.mount(ctx, out); err != nil {
+				return err
+			}
+		}
+		if err := review.hunks(ws.fsys, filter, out); err != nil {
+			return err
+		}
+		if err := p.parseDir(ws.fsys, filter, history.annotate(out)); err != nil {
+			return err
 		}
-	}()
+		return history.recentCommits(ws.fsys, filter, out)
+	}
 
-	for i, pattern := range ignorePatterns {
-		if !strings.HasPrefix(pattern, "/") {
-			ignorePatterns[i] = "**/" + pattern
+	if ws.results == nil {
+		if err := readableDir(ws.fsys); err != nil {
+			return &WalkError{Err: err}
 		}
+		if err := out.revision(ws.revision); err != nil {
+			return err
+		}
+		return walk(out)
+	}
+
+	resultName := fmt.Sprintf("v%d\x00%s\x00\x00%s\x00\x00%+v\x00\x00%+v\x00\x00%s\x00\x00%d", chunkCacheVersion, filter.key(), strings.Join(ws.sparsePaths, "\x00"), p.limits, opts.History, review.key(), opts.SubmoduleDepth)
+
+	var cached struct {
+		Chunks  map[string]ParsedChunk
+		Skipped []SkippedFile
+	}
+	if ws.results.LoadResult(resultName, &cached) {
+		log.Printf("reusing %d parsed chunks of %s at %s", len(cached.Chunks), ws.revision.URL, ws.revision.Commit)
+		if err := out.revision(ws.revision); err != nil {
+			return err
+		}
+		for _, file := range cached.Skipped {
+			if err := out.skipped(file); err != nil {
+				return err
+			}
+		}
+		for _, chunk := range cached.Chunks {
+			if err := out.chunk(chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := readableDir(ws.fsys); err != nil {
+		return &WalkError{Err: err}
+	}
+	if err := out.revision(ws.revision); err != nil {
+		return err
+	}
+
+	// Results with warnings are not cached, since the files that could not be read
+	// may well be readable next time.
+	var warned bool
+	cached.Chunks = make(map[string]ParsedChunk)
+	err = walk(sink{
+		chunk: func(chunk ParsedChunk) error {
+			cached.Chunks[chunk.Location()] = chunk
+			return out.chunk(chunk)
+		},
+		skipped: func(file SkippedFile) error {
+			cached.Skipped = append(cached.Skipped, file)
+			return out.skipped(file)
+		},
+		warning: func(warning ParseWarning) error {
+			warned = true
+			return out.warning(warning)
+		},
+	})
+	if err != nil || warned {
+		return err
 	}
 
-	ignore := ignore.CompileIgnoreLines(ignorePatterns...)
+	if err := ws.results.StoreResult(resultName, cached); err != nil {
+		log.Printf("failed to cache parsed chunks of %s: %v", ws.revision.URL, err)
+	}
 
-	chunks := make(map[string]ParsedChunk, 0)
+	return nil
+}
 
-	filepath.WalkDir(repoDir, func(path string, d fs.DirEntry, err error) error {
+// parseDir parses the files of fsys that pass the filter and the repository's ignore
+// rules, sending chunks, skipped files and warnings to out as it goes. Files are
+// skipped once they exceed the parser's limits; the walk stops when the file count or
+// byte budget is used up. Files and directories that cannot be read are reported as
+// warnings, while errors of out and failures to walk the root itself are returned.
+func (p *Parser) parseDir(fsys fs.FS, filter *fileFilter, out sink) error {
+	ignores := newRepoIgnores(!filter.noDefaultIgnores)
+
+	var (
+		files      int
+		totalBytes int64
+		outErr     error
+	)
+	// skip reports a skipped file and returns ret, or stops the walk if out fails.
+	skip := func(file SkippedFile, ret error) error {
+		if err := out.skipped(file); err != nil {
+			outErr = err
+			return filepath.SkipAll
+		}
+		return ret
+	}
+	// warn reports a file that could not be read and returns ret, or stops the walk if
+	// out fails.
+	warn := func(relPath string, err error, ret error) error {
+		log.Printf("failed to parse %s: %v", relPath, err)
+		if err := out.warning(ParseWarning{Path: relPath, Message: warningMessage(err)}); err != nil {
+			outErr = err
+			return filepath.SkipAll
+		}
+		return ret
+	}
+
+	err := fs.WalkDir(fsys, ".", func(relPath string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return err
+			if relPath == "." {
+				return err
+			}
+			if d != nil && d.IsDir() {
+				return warn(relPath, err, filepath.SkipDir)
+			}
+			return warn(relPath, err, nil)
+		}
+
+		if d.Name() == git.GitDirName && relPath != "." {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
 		if d.IsDir() {
+			if !filter.walkDir(relPath) || relPath != "." && ignores.ignored(relPath, true) {
+				return filepath.SkipDir
+			}
+			ignores.enterDir(fsys, relPath)
 			return nil
 		}
 
-		relPath, err := filepath.Rel(repoDir, path)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path: %w", err)
+		if !filter.matches(relPath) || ignores.ignored(relPath, false) {
+			return nil
 		}
 
-		if ignore.MatchesPath(relPath) {
+		info, err := d.Info()
+		if err != nil {
+			return warn(relPath, err, nil)
+		}
+		if !info.Mode().IsRegular() {
 			return nil
 		}
 
-		file, err := os.Open(path)
+		if p.limits.MaxFileBytes > 0 && info.Size() > p.limits.MaxFileBytes {
+			return skip(SkippedFile{
+				Path:   relPath,
+				Reason: fmt.Sprintf("file is larger than %d bytes", p.limits.MaxFileBytes),
+			}, nil)
+		}
+		if p.limits.MaxFiles > 0 && files >= p.limits.MaxFiles {
+			return skip(SkippedFile{
+				Path:   relPath,
+				Reason: fmt.Sprintf("repository has more than %d files, this and all following files were skipped", p.limits.MaxFiles),
+			}, filepath.SkipAll)
+		}
+		if p.limits.MaxTotalBytes > 0 && totalBytes+info.Size() > p.limits.MaxTotalBytes {
+			return skip(SkippedFile{
+				Path:   relPath,
+				Reason: fmt.Sprintf("repository has more than %d bytes, this and all following files were skipped", p.limits.MaxTotalBytes),
+			}, filepath.SkipAll)
+		}
+
+		file, err := fsys.Open(relPath)
 		if err != nil {
-			return err
+			return warn(relPath, err, nil)
 		}
 		defer file.Close()
 
-		isText, err := p.IsTextFile(file)
-		if err != nil {
-			return fmt.Errorf("failed to check if file is text: %w", err)
+		// The file may have grown since it was stat'ed.
+		var reader io.Reader = file
+		if p.limits.MaxFileBytes > 0 {
+			reader = io.LimitReader(file, p.limits.MaxFileBytes)
 		}
-		if !isText {
+
+		// Like IsTextFile, but without seeking, which files read from the object
+		// storage do not support: binary files are recognized from their first 512
+		// bytes before the rest is read.
+		header := make([]byte, 512)
+		n, err := io.ReadFull(reader, header)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return warn(relPath, fmt.Errorf("failed to read file: %w", err), nil)
+		}
+		if !p.isTextMIME(header[:n]) {
 			return nil
 		}
-
-		content, err := io.ReadAll(file)
+		rest, err := io.ReadAll(reader)
 		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", path, err)
+			return warn(relPath, fmt.Errorf("failed to read file: %w", err), nil)
 		}
-
-		chunk := ParsedChunk{
-			FilePath: relPath,
-			Content:  string(content),
+		content := append(header[:n], rest...)
+		if isLFSPointer(content) {
+			return skip(SkippedFile{
+				Path:   relPath,
+				Reason: "file is a Git LFS pointer, its content is not stored in the repository",
+			}, nil)
+		}
+		if !isValidText(content) {
+			return nil
 		}
 
-		chunks[relPath] = chunk
+		files++
+		totalBytes += int64(len(content))
+
+		language := DetectLanguage(relPath)
+		for _, segment := range p.chunker.Split(relPath, content) {
+			chunk := ParsedChunk{
+				ID:        chunkID(relPath, segment.Content),
+				FilePath:  relPath,
+				Content:   segment.Content,
+				Language:  language,
+				StartLine: segment.StartLine,
+				EndLine:   segment.EndLine,
+				StartByte: segment.StartByte,
+				EndByte:   segment.EndByte,
+			}
+			if err := out.chunk(chunk); err != nil {
+				outErr = err
+				return filepath.SkipAll
+			}
+		}
 
 		return nil
 	})
+	if outErr != nil {
+		return outErr
+	}
+	if err != nil {
+		return &WalkError{Err: err}
+	}
+
+	return nil
+}
+
+// WalkError is returned when the files of a source cannot be walked at all, for
+// example because its root directory is not readable. Files that cannot be read are
+// reported as warnings instead.
+type WalkError struct {
+	Err error
+}
+
+func (e *WalkError) Error() string {
+	return fmt.Sprintf("failed to read repository files: %s", warningMessage(e.Err))
+}
+
+func (e *WalkError) Unwrap() error {
+	return e.Err
+}
 
-	return chunks, nil
+// readableDir checks that the entries of the root of fsys can be listed.
+func readableDir(fsys fs.FS) error {
+	f, err := fsys.Open(".")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return &fs.PathError{Op: "readdir", Path: ".", Err: errors.New("not a directory")}
+	}
+	if _, err := dir.ReadDir(1); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// warningMessage describes err without the server-side paths it may contain.
+func warningMessage(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return fmt.Sprintf("%s: %v", pathErr.Op, pathErr.Err)
+	}
+	return err.Error()
 }
 
 func (p *Parser) Cleanup() error {
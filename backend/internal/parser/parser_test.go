@@ -0,0 +1,177 @@
+package parser_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRepositoryLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"a.txt": "first file\n",
+		"b.txt": strings.Repeat("too large\n", 200),
+		"c.txt": "second file\n",
+		"d.txt": "over the file limit\n",
+		"e.txt": "never visited\n",
+	})
+	p := newTestParser(t, tmpDir, parser.Options{
+		Limits: parser.Limits{
+			MaxFileBytes: 1000,
+			MaxFiles:     2,
+		},
+	})
+
+	result, err := p.ParseRepository(context.Background(), tmpDir, parser.ParseOptions{})
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+
+	if got, want := parsedFiles(result.Chunks), []string{"a.txt", "c.txt"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v to be parsed, got %v", want, got)
+	}
+
+	if len(result.Skipped) != 2 {
+		t.Fatalf("expected 2 skipped files, got %v", result.Skipped)
+	}
+	if result.Skipped[0].Path != "b.txt" || !strings.Contains(result.Skipped[0].Reason, "larger than 1000 bytes") {
+		t.Errorf("expected b.txt to be skipped for its size, got %+v", result.Skipped[0])
+	}
+	if result.Skipped[1].Path != "d.txt" || !strings.Contains(result.Skipped[1].Reason, "more than 2 files") {
+		t.Errorf("expected d.txt to be skipped for the file limit, got %+v", result.Skipped[1])
+	}
+}
+
+func TestParseRepositoryStream(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := make(map[string]string)
+	for i := range 5 {
+		files[fmt.Sprintf("file%d.txt", i)] = fmt.Sprintf("content of file %d\n", i)
+	}
+	writeFiles(t, tmpDir, files)
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	expected, err := p.ParseRepository(context.Background(), tmpDir, parser.ParseOptions{})
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+
+	revisionChan := make(chan parser.Revision, 1)
+	chunkChan := make(chan parser.ParsedChunk)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(chunkChan)
+		errChan <- p.ParseRepositoryStream(context.Background(), tmpDir, parser.ParseOptions{}, revisionChan, chunkChan, nil, nil)
+	}()
+
+	streamed := make(map[string]parser.ParsedChunk)
+	for chunk := range chunkChan {
+		streamed[chunk.Location()] = chunk
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("failed to stream repository: %v", err)
+	}
+
+	if revision := <-revisionChan; revision != expected.Revision {
+		t.Errorf("expected revision %+v, got %+v", expected.Revision, revision)
+	}
+	if len(streamed) != len(expected.Chunks) {
+		t.Fatalf("expected %d chunks, got %d", len(expected.Chunks), len(streamed))
+	}
+	for key, chunk := range expected.Chunks {
+		if streamed[key] != chunk {
+			t.Errorf("expected chunk %s to be streamed as %+v, got %+v", key, chunk, streamed[key])
+		}
+	}
+
+	// Cancelling the stream stops the walk.
+	ctx, cancel := context.WithCancel(context.Background())
+	chunkChan = make(chan parser.ParsedChunk)
+	go func() {
+		<-chunkChan
+		cancel()
+	}()
+	if err := p.ParseRepositoryStream(ctx, tmpDir, parser.ParseOptions{}, nil, chunkChan, nil, nil); err != context.Canceled {
+		t.Errorf("expected the cancelled stream to fail with %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestParseRepositoryReportsUnreadableFiles(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions are not enforced for root")
+	}
+
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	writeFiles(t, repoDir, map[string]string{
+		"readable.txt":        "readable\n",
+		"unreadable.txt":      "unreadable\n",
+		"locked/readable.txt": "behind a locked directory\n",
+	})
+	for _, name := range []string{"unreadable.txt", "locked"} {
+		path := filepath.Join(repoDir, name)
+		if err := os.Chmod(path, 0); err != nil {
+			t.Fatalf("failed to change permissions: %v", err)
+		}
+		defer os.Chmod(path, 0755)
+	}
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	result, err := p.ParseRepository(context.Background(), repoDir, parser.ParseOptions{})
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+
+	if len(result.Chunks) != 1 {
+		t.Errorf("expected only readable.txt to be parsed, got %v", result.Chunks)
+	}
+
+	warned := make(map[string]bool)
+	for _, warning := range result.Warnings {
+		if strings.Contains(warning.Message, tmpDir) {
+			t.Errorf("expected warning to hide the server path, got %q", warning.Message)
+		}
+		warned[warning.Path] = true
+	}
+	if len(warned) != 2 || !warned["unreadable.txt"] || !warned["locked"] {
+		t.Errorf("expected warnings for unreadable.txt and locked, got %+v", result.Warnings)
+	}
+
+	// A repository that cannot be walked at all fails the parse.
+	if err := os.Chmod(repoDir, 0111); err != nil {
+		t.Fatalf("failed to change permissions: %v", err)
+	}
+	defer os.Chmod(repoDir, 0755)
+
+	_, err = p.ParseRepository(context.Background(), repoDir, parser.ParseOptions{})
+	var walkErr *parser.WalkError
+	if !errors.As(err, &walkErr) {
+		t.Errorf("expected a walk error, got %v", err)
+	}
+}
+
+func TestParseRepositoryReportsRequestedLocalPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	writeFiles(t, repoDir, map[string]string{"main.go": "package main\n"})
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Symlink(repoDir, link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	// The resolved directory stays on the server.
+	result, err := p.ParseRepository(context.Background(), link, parser.ParseOptions{})
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+	if result.Revision.URL != link {
+		t.Errorf("expected the revision to name %s, got %s", link, result.Revision.URL)
+	}
+}
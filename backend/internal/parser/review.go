@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"fmt"
+	"io/fs"
+	"rankmyrepo/internal/repocache"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// reviewContextLines is how many unchanged lines surround the changed lines of a hunk.
+const reviewContextLines = 10
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// review is the change from a base ref to the parsed revision.
+type review struct {
+	parser *Parser
+	// from is the merge base of the base ref and the parsed commit, so the review
+	// only covers the changes made on the parsed side, like a pull request.
+	from *object.Commit
+	to   *object.Commit
+}
+
+// newReview returns the change from baseRef to the revision of the workspace and adds
+// the base to the revision, or returns nil if no base ref was given.
+func (p *Parser) newReview(ws *workspace, baseRef string) (*review, error) {
+	if baseRef == "" {
+		return nil, nil
+	}
+	if err := fullHistory(ws); err != nil {
+		return nil, err
+	}
+
+	baseHash, err := repocache.Resolve(ws.repo, baseRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve base ref: %w", err)
+	}
+	base, err := ws.repo.CommitObject(baseHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", baseHash, err)
+	}
+	head, err := ws.repo.CommitObject(plumbing.NewHash(ws.revision.Commit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", ws.revision.Commit, err)
+	}
+
+	from := base
+	mergeBases, err := head.MergeBase(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merge base of %s and %s: %w", baseHash, head.Hash, err)
+	}
+	if len(mergeBases) > 0 {
+		from = mergeBases[0]
+	}
+
+	ws.revision.BaseRef = baseRef
+	ws.revision.BaseCommit = baseHash.String()
+
+	return &review{parser: p, from: from, to: head}, nil
+}
+
+// key identifies the change in the names of cached parse results.
+func (r *review) key() string {
+	if r == nil {
+		return ""
+	}
+	return r.from.Hash.String()
+}
+
+// hunks sends a chunk for each hunk of the change to a file that passes the filter.
+// Binary files are left out and changes larger than the file size limit are reported as
+// skipped.
+func (r *review) hunks(fsys fs.FS, filter *fileFilter, out sink) error {
+	if r == nil {
+		return nil
+	}
+
+	fromTree, err := r.from.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree of %s: %w", r.from.Hash, err)
+	}
+	toTree, err := r.to.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree of %s: %w", r.to.Hash, err)
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return fmt.Errorf("failed to diff %s and %s: %w", r.from.Hash, r.to.Hash, err)
+	}
+
+	limits := r.parser.limits
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		if !filter.matches(name) || ignoredAt(fsys, name, !filter.noDefaultIgnores) {
+			continue
+		}
+
+		patch, err := change.Patch()
+		if err != nil {
+			return fmt.Errorf("failed to diff %s: %w", name, err)
+		}
+		if binaryPatch(patch) {
+			continue
+		}
+
+		var b strings.Builder
+		if err := diff.NewUnifiedEncoder(&b, reviewContextLines).Encode(patch); err != nil {
+			return fmt.Errorf("failed to diff %s: %w", name, err)
+		}
+		if limits.MaxFileBytes > 0 && int64(b.Len()) > limits.MaxFileBytes {
+			if err := out.skipped(SkippedFile{
+				Path:   name,
+				Reason: fmt.Sprintf("change is larger than %d bytes", limits.MaxFileBytes),
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, chunk := range hunkChunks(name, change.To.Name == "", b.String()) {
+			if err := out.chunk(chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hunkChunks splits the unified diff of a file into one chunk per hunk. Each chunk
+// repeats the ---/+++ lines of the diff and spans the lines of the hunk in the new
+// version of the file, or in the old version if the file was deleted.
+func hunkChunks(filePath string, deleted bool, patch string) []ParsedChunk {
+	var header []string
+	var chunks []ParsedChunk
+	var hunk []string
+	var start, end int
+
+	flush := func() {
+		if hunk == nil {
+			return
+		}
+		content := strings.Join(append(header[:len(header):len(header)], hunk...), "\n") + "\n"
+		chunks = append(chunks, ParsedChunk{
+			ID:        chunkID(filePath, content),
+			FilePath:  filePath,
+			Content:   content,
+			Language:  "diff",
+			StartLine: start,
+			EndLine:   end,
+			Hunk:      true,
+		})
+		hunk = nil
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		match := hunkHeader.FindStringSubmatch(line)
+		switch {
+		case match != nil:
+			flush()
+			first, count := match[3], match[4]
+			if deleted {
+				first, count = match[1], match[2]
+			}
+			start, end = hunkRange(first, count)
+			hunk = []string{line}
+		case hunk != nil:
+			hunk = append(hunk, line)
+		case strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ "):
+			header = append(header, line)
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// hunkRange returns the first and last line of a hunk header's "start,count" range. An
+// empty range, as left by removed lines, spans its start line.
+func hunkRange(line, count string) (int, int) {
+	start, _ := strconv.Atoi(line)
+	n := 1
+	if count != "" {
+		n, _ = strconv.Atoi(count)
+	}
+	return max(start, 1), max(start+n-1, start, 1)
+}
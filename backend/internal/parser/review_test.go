@@ -0,0 +1,93 @@
+package parser_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"rankmyrepo/internal/repocache"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseRepositoryReview(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+
+	var lines []string
+	for i := 1; i <= 60; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	base := strings.Join(lines, "\n") + "\n"
+	lines[4], lines[49] = "changed 5", "changed 50"
+	head := strings.Join(lines, "\n") + "\n"
+
+	baseHash := newTestRepo(t, repoDir, map[string]string{"lines.txt": base}).String()
+	commit(t, repoDir, testCommit{message: "update lines", files: map[string]string{"lines.txt": head}})
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	result, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{BaseRef: baseHash})
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+
+	if result.Revision.BaseCommit != baseHash {
+		t.Errorf("expected base commit %s, got %s", baseHash, result.Revision.BaseCommit)
+	}
+
+	// The changes are too far apart to share a hunk.
+	var hunks []string
+	for location, chunk := range result.Chunks {
+		if !chunk.Hunk {
+			continue
+		}
+		hunks = append(hunks, location)
+		if !strings.Contains(chunk.Content, "-line 5\n+changed 5\n") && !strings.Contains(chunk.Content, "-line 50\n+changed 50\n") {
+			t.Errorf("expected %s to contain a change, got %q", location, chunk.Content)
+		}
+	}
+	sort.Strings(hunks)
+	if strings.Join(hunks, ",") != "lines.txt:1-15 (diff),lines.txt:40-60 (diff)" {
+		t.Errorf("expected two hunks with context, got %v", hunks)
+	}
+	if _, ok := result.Chunks["lines.txt:1-60"]; !ok {
+		t.Errorf("expected the file to be parsed as well, got %v", result.Chunks)
+	}
+}
+
+func TestParseRepositoryReviewDeepensCachedClones(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	baseHash := newTestRepo(t, repoDir, map[string]string{"main.go": "package main\n"}).String()
+	commit(t, repoDir, testCommit{message: "add func", files: map[string]string{"main.go": "package main\n\nfunc main() {}\n"}})
+
+	cache, err := repocache.NewCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	p := newTestParser(t, tmpDir, parser.Options{Cache: cache})
+
+	// The first request leaves a shallow clone without the base commit in the cache.
+	if _, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{CloneMode: repocache.CloneShallow}); err != nil {
+		t.Fatalf("failed to parse shallow clone: %v", err)
+	}
+
+	result, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{BaseRef: baseHash})
+	if err != nil {
+		t.Fatalf("failed to review the cached clone: %v", err)
+	}
+	if result.Revision.BaseCommit != baseHash {
+		t.Errorf("expected base commit %s, got %s", baseHash, result.Revision.BaseCommit)
+	}
+
+	var hunks int
+	for _, chunk := range result.Chunks {
+		if chunk.Hunk {
+			hunks++
+		}
+	}
+	if hunks != 1 {
+		t.Errorf("expected the change as one hunk, got %d", hunks)
+	}
+}
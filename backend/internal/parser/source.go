@@ -0,0 +1,264 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"rankmyrepo/internal/repocache"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// source provides the files of a repository, archive or local directory for parsing.
+type source interface {
+	open(ctx context.Context) (*workspace, error)
+}
+
+// workspace holds the files of a source. It is only valid until release is called.
+type workspace struct {
+	fsys     fs.FS
+	revision Revision
+	// repo is the Git repository the revision was read from, nil for sources without
+	// history.
+	repo *git.Repository
+	// sparsePaths are the only directories that were checked out, if the clone is
+	// sparse.
+	sparsePaths []string
+	// results caches parse results of the revision; it is nil for sources whose
+	// contents are not identified by a commit.
+	results *repocache.Checkout
+	release func()
+	// mount adds the files of submodules to fsys, if the parse asked for them. It is
+	// only called when the files are walked, so cached results need no submodules.
+	mount func(ctx context.Context, out sink) error
+	// submodules are the paths submodules were mounted at.
+	submodules []string
+}
+
+// gitSource clones a Git repository, through the repository cache if one is
+// configured.
+type gitSource struct {
+	parser         *Parser
+	url            string
+	urlCredentials *Credentials
+	opts           ParseOptions
+}
+
+func (s *gitSource) open(ctx context.Context) (*workspace, error) {
+	ws, err := s.openRepository(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if depth := s.opts.SubmoduleDepth; depth > 0 {
+		ws.mount = func(ctx context.Context, out sink) error {
+			return s.mountSubmodules(ctx, ws, depth, out)
+		}
+	}
+	return ws, nil
+}
+
+func (s *gitSource) openRepository(ctx context.Context) (*workspace, error) {
+	p := s.parser
+
+	creds := s.opts.Credentials
+	if creds.empty() {
+		creds = s.urlCredentials
+	}
+	if creds.empty() {
+		creds = p.credentials.lookup(s.url)
+	}
+
+	auth, err := creds.authMethod(s.url)
+	if err != nil {
+		return nil, redact(err, creds)
+	}
+
+	cloneOpts, err := p.cloneOptions(ctx, s.url, s.opts, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.opts.InMemory {
+		repo, commit, err := repocache.CloneMemory(ctx, s.url, s.opts.Ref, auth, cloneOpts)
+		if err != nil {
+			return nil, redact(err, creds)
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tree of %s: %w", commit.Hash, err)
+		}
+
+		return &workspace{
+			fsys:        newTreeFS(tree, cloneOpts.SparsePaths),
+			revision:    Revision{URL: s.url, Ref: s.opts.Ref, Commit: commit.Hash.String()},
+			repo:        repo,
+			sparsePaths: cloneOpts.SparsePaths,
+			release:     func() {},
+		}, nil
+	}
+
+	if p.cache != nil {
+		checkout, err := p.cache.Checkout(ctx, s.url, s.opts.Ref, auth, cloneOpts)
+		if err != nil {
+			return nil, redact(err, creds)
+		}
+		repo, err := git.PlainOpen(checkout.Dir)
+		if err != nil {
+			checkout.Release()
+			return nil, fmt.Errorf("failed to open cached clone: %w", err)
+		}
+
+		// Concurrent requests may check out other commits of the cached clone while
+		// this one is parsed, so its files are read from the commit rather than the
+		// working tree.
+		commit, err := repo.CommitObject(plumbing.NewHash(checkout.Commit))
+		if err != nil {
+			checkout.Release()
+			return nil, fmt.Errorf("failed to read commit %s: %w", checkout.Commit, err)
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			checkout.Release()
+			return nil, fmt.Errorf("failed to read tree of %s: %w", commit.Hash, err)
+		}
+
+		return &workspace{
+			fsys:        newTreeFS(tree, cloneOpts.SparsePaths),
+			revision:    Revision{URL: s.url, Ref: s.opts.Ref, Commit: checkout.Commit},
+			repo:        repo,
+			sparsePaths: cloneOpts.SparsePaths,
+			results:     checkout,
+			release:     checkout.Release,
+		}, nil
+	}
+
+	repoDir, commit, release, err := p.clones.checkout(ctx, s.url, s.opts.Ref, auth, cloneOpts, creds)
+	if err != nil {
+		return nil, redact(err, creds)
+	}
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to open clone: %w", err)
+	}
+
+	return &workspace{
+		fsys:        os.DirFS(repoDir),
+		revision:    Revision{URL: s.url, Ref: s.opts.Ref, Commit: commit},
+		repo:        repo,
+		sparsePaths: cloneOpts.SparsePaths,
+		release:     release,
+	}, nil
+}
+
+// localSource parses a directory on the server in place. If it is a Git checkout, the
+// commit of its HEAD is reported, although uncommitted changes are parsed as well.
+type localSource struct {
+	dir string
+	// path is the directory as the request named it. It is reported instead of dir,
+	// which is resolved on the server and must not reach clients.
+	path    string
+	ref     string
+	history bool
+}
+
+func (s *localSource) open(ctx context.Context) (*workspace, error) {
+	if s.ref != "" {
+		return nil, errors.New("refs are not supported for local directories, use a file:// URL instead")
+	}
+	if s.history {
+		return nil, errors.New("history and reviews are not supported for local directories, use a file:// URL instead")
+	}
+
+	ws := &workspace{
+		fsys:     os.DirFS(s.dir),
+		revision: Revision{URL: s.path},
+		release:  func() {},
+	}
+
+	repo, err := git.PlainOpenWithOptions(s.dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err == nil {
+		if head, err := repo.Head(); err == nil {
+			ws.revision.Commit = head.Hash().String()
+		}
+	}
+
+	return ws, nil
+}
+
+// archiveSource extracts an uploaded archive into a temporary directory.
+type archiveSource struct {
+	tempDir string
+	path    string
+	name    string
+}
+
+func (s *archiveSource) open(ctx context.Context) (*workspace, error) {
+	dir, err := os.MkdirTemp(s.tempDir, "archive-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	release := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("warning: failed to clean up archive directory: %v\n", err)
+		}
+	}
+
+	digest, err := extractArchive(ctx, s.path, s.name, dir)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return &workspace{
+		fsys:     os.DirFS(singleTopLevelDir(dir)),
+		revision: Revision{URL: s.name, Commit: digest},
+		release:  release,
+	}, nil
+}
+
+// localPath resolves path, following symlinks, and checks that it is a directory
+// below one of the local roots.
+func (p *Parser) localPath(path string) (string, error) {
+	if len(p.localRoots) == 0 {
+		return "", errors.New("local sources are not enabled on this server")
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("local path %s is not accessible", path)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", fmt.Errorf("local path %s is not accessible", path)
+	}
+
+	for _, root := range p.localRoots {
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		root, err = filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(root, resolved)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+
+		info, err := os.Stat(resolved)
+		if err != nil || !info.IsDir() {
+			return "", fmt.Errorf("local path %s is not a directory", path)
+		}
+		return resolved, nil
+	}
+
+	return "", fmt.Errorf("local path %s is outside of the allowed roots", path)
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+)
+
+// GoSplitter splits Go source files along top-level declarations using go/ast.
+// Doc comments stay attached to the declaration they document and import blocks
+// are left in the file preamble.
+type GoSplitter struct{}
+
+func (s *GoSplitter) Boundaries(content []byte) ([]Boundary, error) {
+	fset := token.NewFileSet()
+	file, err := goparser.ParseFile(fset, "", content, goparser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go file: %w", err)
+	}
+
+	var boundaries []Boundary
+	for _, decl := range file.Decls {
+		var (
+			pos  = decl.Pos()
+			name string
+		)
+
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				pos = d.Doc.Pos()
+			}
+			name = goFuncName(d)
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			if d.Doc != nil {
+				pos = d.Doc.Pos()
+			}
+			name = goGenDeclName(d)
+		}
+
+		boundaries = append(boundaries, Boundary{
+			Line: fset.Position(pos).Line,
+			Name: name,
+		})
+	}
+
+	return boundaries, nil
+}
+
+func goFuncName(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return d.Name.Name
+	}
+
+	return fmt.Sprintf("(%s).%s", goExprString(d.Recv.List[0].Type), d.Name.Name)
+}
+
+func goGenDeclName(d *ast.GenDecl) string {
+	if len(d.Specs) != 1 {
+		return d.Tok.String()
+	}
+
+	switch spec := d.Specs[0].(type) {
+	case *ast.TypeSpec:
+		return spec.Name.Name
+	case *ast.ValueSpec:
+		if len(spec.Names) > 0 {
+			return spec.Names[0].Name
+		}
+	}
+	return d.Tok.String()
+}
+
+func goExprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return "*" + goExprString(e.X)
+	case *ast.IndexExpr:
+		return goExprString(e.X)
+	case *ast.IndexListExpr:
+		return goExprString(e.X)
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUnitName(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"trims braces and colons", "  def parse(self):  ", "def parse(self)"},
+		{"short names are kept", "class Parser {", "class Parser"},
+		{"long names are cut", "function " + strings.Repeat("a", 100) + "() {", "function " + strings.Repeat("a", 71)},
+		// "é" takes two bytes, so the 80th byte starts in the middle of a rune.
+		{"cut at a rune boundary", "fn " + strings.Repeat("é", 50), "fn " + strings.Repeat("é", 38)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unitName(tt.line)
+			if got != tt.want {
+				t.Errorf("unitName(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("unitName(%q) = %q is not valid UTF-8", tt.line, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package parser
+
+import "fmt"
+
+// LineSplitter cuts a range of lines into fixed-size, overlapping windows. It is the
+// fallback for files without a registered splitter and for units too large to rank
+// as a whole.
+type LineSplitter struct {
+	window  int
+	overlap int
+}
+
+func NewLineSplitter(window, overlap int) *LineSplitter {
+	if window < 1 {
+		window = 1
+	}
+	if overlap < 0 || overlap >= window {
+		overlap = 0
+	}
+
+	return &LineSplitter{
+		window:  window,
+		overlap: overlap,
+	}
+}
+
+func (s *LineSplitter) split(content []byte, lines []int, name string, start, end int) []Segment {
+	var segments []Segment
+	for from := start; from <= end; from += s.window - s.overlap {
+		to := min(from+s.window-1, end)
+
+		windowName := name
+		if windowName != "" && (from != start || to != end) {
+			windowName = fmt.Sprintf("%s (lines %d-%d)", name, from, to)
+		}
+
+		segments = append(segments, newSegment(content, lines, windowName, from, to))
+		if to == end {
+			break
+		}
+	}
+	return segments
+}
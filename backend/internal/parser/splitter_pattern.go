@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// PatternSplitter finds unit boundaries with line-based regular expressions. It is
+// meant for languages without a native parser in Go; comment and decorator lines
+// directly above a match are kept with the unit that follows them.
+type PatternSplitter struct {
+	patterns        []*regexp.Regexp
+	leadingPrefixes []string
+}
+
+func NewPatternSplitter(patterns []string, leadingPrefixes []string) *PatternSplitter {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		compiled = append(compiled, regexp.MustCompile(pattern))
+	}
+
+	return &PatternSplitter{
+		patterns:        compiled,
+		leadingPrefixes: leadingPrefixes,
+	}
+}
+
+func (s *PatternSplitter) Boundaries(content []byte) ([]Boundary, error) {
+	lines := strings.Split(string(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))), "\n")
+
+	var boundaries []Boundary
+	for i, line := range lines {
+		if !s.matches(line) {
+			continue
+		}
+
+		start := i
+		for start > 0 && s.isLeading(lines[start-1]) {
+			start--
+		}
+
+		boundaries = append(boundaries, Boundary{
+			Line: start + 1,
+			Name: unitName(line),
+		})
+	}
+
+	return boundaries, nil
+}
+
+func (s *PatternSplitter) matches(line string) bool {
+	for _, pattern := range s.patterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PatternSplitter) isLeading(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range s.leadingPrefixes {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func unitName(line string) string {
+	name := strings.TrimSpace(line)
+	name = strings.TrimRight(name, "{:")
+	name = strings.TrimSpace(name)
+	if len(name) > 80 {
+		// Cut at a rune boundary, so the name stays valid UTF-8.
+		end := 80
+		for end > 0 && !utf8.RuneStart(name[end]) {
+			end--
+		}
+		name = name[:end]
+	}
+	return name
+}
+
+func patternSplitters() map[string]Splitter {
+	python := NewPatternSplitter([]string{
+		`^(async\s+)?def\s+\w+`,
+		`^class\s+\w+`,
+	}, []string{"#", "@"})
+
+	javascript := NewPatternSplitter([]string{
+		`^(export\s+)?(default\s+)?(async\s+)?function\b`,
+		`^(export\s+)?(default\s+)?(abstract\s+)?class\s+\w+`,
+		`^(export\s+)?(const|let|var)\s+\w+\s*=\s*(async\s+)?(\(|function\b|\w+\s*=>)`,
+		`^(export\s+)?(declare\s+)?(interface|type|enum)\s+\w+`,
+	}, []string{"//", "/*", "*", "@"})
+
+	rust := NewPatternSplitter([]string{
+		`^(pub(\([\w:]+\))?\s+)?(const\s+)?(async\s+)?(unsafe\s+)?(extern\s+"\w+"\s+)?fn\s+\w+`,
+		`^(pub(\([\w:]+\))?\s+)?(struct|enum|trait|union|type|mod)\s+\w+`,
+		`^(unsafe\s+)?impl\b`,
+	}, []string{"//", "#["})
+
+	java := NewPatternSplitter([]string{
+		`^ {0,4}(public|protected|private|internal)\s[^;=]*\(`,
+		`^ {0,4}(\w+\s+)*fun\s+\w+`,
+		`^(public\s+|private\s+|protected\s+|internal\s+)?(abstract\s+|final\s+|sealed\s+|data\s+|static\s+)*(class|interface|enum|record|object)\s+\w+`,
+	}, []string{"//", "/*", "*", "@"})
+
+	ruby := NewPatternSplitter([]string{
+		`^\s{0,2}(def|class|module)\s+`,
+	}, []string{"#"})
+
+	return map[string]Splitter{
+		".py":   python,
+		".js":   javascript,
+		".jsx":  javascript,
+		".mjs":  javascript,
+		".cjs":  javascript,
+		".ts":   javascript,
+		".tsx":  javascript,
+		".rs":   rust,
+		".java": java,
+		".kt":   java,
+		".cs":   java,
+		".rb":   ruby,
+	}
+}
@@ -0,0 +1,272 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// maxSubmoduleDepth bounds how deep a parse may recurse into submodules.
+const maxSubmoduleDepth = 5
+
+// mountSubmodules clones the submodules of the workspace's commit at the commits it pins
+// them to and mounts their files at their paths, recursing while depth allows.
+// Submodules that cannot be cloned are reported as warnings and left out; only errors
+// of out and ctx are returned.
+func (s *gitSource) mountSubmodules(ctx context.Context, ws *workspace, depth int, out sink) error {
+	commit, err := ws.repo.CommitObject(plumbing.NewHash(ws.revision.Commit))
+	if err != nil {
+		return fmt.Errorf("failed to read commit %s: %w", ws.revision.Commit, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree of %s: %w", commit.Hash, err)
+	}
+
+	file, err := tree.File(".gitmodules")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+	data, err := file.Contents()
+	if err != nil {
+		return fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+	modules := config.NewModules()
+	if err := modules.Unmarshal([]byte(data)); err != nil {
+		return out.warning(ParseWarning{Path: ".gitmodules", Message: "failed to read submodules: " + err.Error()})
+	}
+
+	mounts := &mountFS{base: ws.fsys, mounts: make(map[string]fs.FS)}
+	filter := newFileFilter(s.opts)
+
+	// Submodules are mounted in path order, so warnings are reported in a stable order.
+	names := make([]string, 0, len(modules.Submodules))
+	for name := range modules.Submodules {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return modules.Submodules[names[i]].Path < modules.Submodules[names[j]].Path
+	})
+
+	for _, name := range names {
+		module := modules.Submodules[name]
+		if err := module.Validate(); err != nil {
+			if err := out.warning(ParseWarning{Path: module.Path, Message: "invalid submodule: " + err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		modulePath := path.Clean(module.Path)
+		if !filter.walkDir(modulePath) || !visibleIn(ws.sparsePaths, modulePath) {
+			continue
+		}
+
+		entry, err := tree.FindEntry(modulePath)
+		if err != nil || entry.Mode != filemode.Submodule {
+			// Submodules that were removed from the tree but not from .gitmodules.
+			continue
+		}
+
+		sub, err := s.openSubmodule(ctx, ws, module.URL, entry.Hash, depth, out, modulePath)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("failed to clone submodule %s: %v", modulePath, err)
+			if err := out.warning(ParseWarning{Path: modulePath, Message: "failed to clone submodule: " + err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		mounts.mounts[modulePath] = sub.fsys
+		ws.submodules = append(ws.submodules, modulePath)
+		for _, nested := range sub.submodules {
+			ws.submodules = append(ws.submodules, path.Join(modulePath, nested))
+		}
+	}
+
+	if len(mounts.mounts) > 0 {
+		ws.fsys = mounts
+	}
+	return nil
+}
+
+// openSubmodule clones the submodule at url and commit, and its own submodules if depth
+// allows. The clone is released with the workspace ws. Warnings of nested submodules
+// are reported below modulePath.
+func (s *gitSource) openSubmodule(ctx context.Context, ws *workspace, url string, commit plumbing.Hash, depth int, out sink, modulePath string) (*workspace, error) {
+	src, err := s.submodule(url, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := src.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	release := ws.release
+	ws.release = func() {
+		sub.release()
+		release()
+	}
+
+	if depth > 1 {
+		nestedOut := out
+		nestedOut.warning = func(warning ParseWarning) error {
+			warning.Path = path.Join(modulePath, warning.Path)
+			return out.warning(warning)
+		}
+		if err := src.mountSubmodules(ctx, sub, depth-1, nestedOut); err != nil {
+			return nil, err
+		}
+	}
+
+	return sub, nil
+}
+
+// submodule returns the source of a submodule of s. Relative URLs are resolved against
+// the URL of s, and local URLs must lie below the local roots like any other. The
+// credentials of s are only passed on to submodules on the same host; others fall back
+// to the credentials configured on the server.
+func (s *gitSource) submodule(url string, commit plumbing.Hash) (*gitSource, error) {
+	parent, err := transport.NewEndpoint(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	if strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") {
+		endpoint := *parent
+		endpoint.Path = path.Join(parent.Path, url)
+		url = endpoint.String()
+	}
+	url, urlCredentials := splitURLCredentials(url)
+
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid submodule URL: %w", err)
+	}
+	if endpoint.Protocol == "file" {
+		if _, err := s.parser.localPath(endpoint.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	var creds *Credentials
+	if strings.EqualFold(endpoint.Host, parent.Host) {
+		creds = s.opts.Credentials
+		if creds.empty() {
+			creds = s.urlCredentials
+		}
+	}
+
+	return &gitSource{
+		parser:         s.parser,
+		url:            url,
+		urlCredentials: urlCredentials,
+		opts: ParseOptions{
+			Ref:         commit.String(),
+			InMemory:    s.opts.InMemory,
+			Credentials: creds,
+		},
+	}, nil
+}
+
+// inSubmodule reports whether the file at relPath belongs to a mounted submodule.
+func (ws *workspace) inSubmodule(relPath string) bool {
+	for _, dir := range ws.submodules {
+		if isWithin(relPath, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func visibleIn(sparsePaths []string, dir string) bool {
+	if len(sparsePaths) == 0 {
+		return true
+	}
+	for _, sparse := range sparsePaths {
+		sparse = path.Clean("/" + sparse)[1:]
+		if isWithin(dir, sparse) || isWithin(sparse, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// mountFS overlays file systems at directories of a base file system, the way
+// submodules are checked out into the working tree of their parent.
+type mountFS struct {
+	base   fs.FS
+	mounts map[string]fs.FS
+}
+
+// resolve returns the file system name lies in and its path there.
+func (m *mountFS) resolve(name string) (fs.FS, string) {
+	for dir, fsys := range m.mounts {
+		if name == dir {
+			return fsys, "."
+		}
+		if rel, ok := strings.CutPrefix(name, dir+"/"); ok {
+			return fsys, rel
+		}
+	}
+	return m.base, name
+}
+
+func (m *mountFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys, rel := m.resolve(name)
+	return fsys.Open(rel)
+}
+
+// ReadDir lists mount points as directories, whether the base file system has an empty
+// directory, a submodule entry or nothing at all in their place.
+func (m *mountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys, rel := m.resolve(name)
+	entries, err := fs.ReadDir(fsys, rel)
+	if err != nil || fsys != m.base {
+		return entries, err
+	}
+
+	listed := make(map[string]bool)
+	for i, entry := range entries {
+		if _, ok := m.mounts[path.Join(name, entry.Name())]; ok {
+			entries[i] = mountPoint(entry.Name())
+			listed[entry.Name()] = true
+		}
+	}
+	for dir := range m.mounts {
+		if path.Dir(dir) == name && !listed[path.Base(dir)] {
+			entries = append(entries, mountPoint(path.Base(dir)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+func mountPoint(name string) fs.DirEntry {
+	return fs.FileInfoToDirEntry(treeFileInfo{name: name, mode: fs.ModeDir | 0555})
+}
@@ -0,0 +1,69 @@
+package parser_test
+
+import (
+	"context"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"rankmyrepo/internal/repocache"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestParseRepositorySubmodules(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	deep := newTestRepo(t, filepath.Join(tmpDir, "deep"), map[string]string{"deep.txt": "deep\n"})
+	lib := commit(t, filepath.Join(tmpDir, "lib"), testCommit{
+		message: "add files",
+		files: map[string]string{
+			"lib.txt":     "lib\n",
+			".gitmodules": "[submodule \"deep\"]\n\tpath = deep\n\turl = ../deep\n",
+		},
+		submodules: map[string]plumbing.Hash{"deep": deep},
+	})
+	commit(t, filepath.Join(tmpDir, "repo"), testCommit{
+		message: "add files",
+		files: map[string]string{
+			"main.txt":    "main\n",
+			"model.bin":   "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n",
+			".gitmodules": "[submodule \"lib\"]\n\tpath = lib\n\turl = ../lib\n",
+		},
+		submodules: map[string]plumbing.Hash{"lib": lib},
+	})
+	cache, err := repocache.NewCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	// Cached clones of the repositories are checked out while their parent is parsed.
+	for name, opts := range map[string]parser.Options{
+		"without cache": {},
+		"with cache":    {Cache: cache},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := newTestParser(t, tmpDir, opts)
+
+			for depth, expected := range []string{
+				".gitmodules,main.txt",
+				".gitmodules,lib/.gitmodules,lib/lib.txt,main.txt",
+				".gitmodules,lib/.gitmodules,lib/deep/deep.txt,lib/lib.txt,main.txt",
+			} {
+				result, err := p.ParseRepository(context.Background(), "file://"+filepath.Join(tmpDir, "repo"), parser.ParseOptions{SubmoduleDepth: depth})
+				if err != nil {
+					t.Fatalf("failed to parse repository with submodule depth %d: %v", depth, err)
+				}
+
+				files := parsedFiles(result.Chunks)
+				if strings.Join(files, ",") != expected {
+					t.Errorf("expected files %s with submodule depth %d, got %v", expected, depth, files)
+				}
+
+				if len(result.Skipped) != 1 || result.Skipped[0].Path != "model.bin" {
+					t.Errorf("expected the LFS pointer to be skipped, got %v", result.Skipped)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// treeFS exposes the files of a Git tree as an fs.FS, reading them straight from the
+// repository's object storage. Nothing is written to disk and there is no .git
+// directory to skip. With sparse paths only the files below them are listed.
+type treeFS struct {
+	root        *object.Tree
+	sparsePaths []string
+}
+
+func newTreeFS(root *object.Tree, sparsePaths []string) *treeFS {
+	paths := make([]string, 0, len(sparsePaths))
+	for _, dir := range sparsePaths {
+		if dir = path.Clean("/" + dir)[1:]; dir != "" {
+			paths = append(paths, dir)
+		}
+	}
+	return &treeFS{root: root, sparsePaths: paths}
+}
+
+func (t *treeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return &treeDir{fsys: t, name: name, tree: t.root, info: treeFileInfo{name: name, mode: fs.ModeDir | 0555}}, nil
+	}
+
+	if !t.visible(name, true) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	entry, err := t.root.FindEntry(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	switch {
+	case entry.Mode == filemode.Dir:
+		tree, err := t.root.Tree(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &treeDir{fsys: t, name: name, tree: tree, info: treeFileInfo{name: entry.Name, mode: fs.ModeDir | 0555}}, nil
+	case entry.Mode.IsFile():
+		file, err := t.root.TreeEntryFile(entry)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		reader, err := file.Reader()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &treeFile{ReadCloser: reader, info: treeFileInfo{name: entry.Name, size: file.Size, mode: fileMode(entry.Mode)}}, nil
+	default:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+}
+
+// visible reports whether name lies below one of the sparse paths, or, for
+// directories, leads to one.
+func (t *treeFS) visible(name string, isDir bool) bool {
+	if len(t.sparsePaths) == 0 {
+		return true
+	}
+	for _, dir := range t.sparsePaths {
+		if isWithin(name, dir) || isDir && isWithin(dir, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileMode maps Git file modes to the closest fs.FileMode. Submodules are irregular
+// files, since their contents are not part of the tree.
+func fileMode(mode filemode.FileMode) fs.FileMode {
+	switch mode {
+	case filemode.Dir:
+		return fs.ModeDir | 0555
+	case filemode.Executable:
+		return 0555
+	case filemode.Symlink:
+		return fs.ModeSymlink | 0444
+	case filemode.Submodule:
+		return fs.ModeIrregular
+	default:
+		return 0444
+	}
+}
+
+type treeFileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (i treeFileInfo) Name() string       { return i.name }
+func (i treeFileInfo) Size() int64        { return i.size }
+func (i treeFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i treeFileInfo) ModTime() time.Time { return time.Time{} }
+func (i treeFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i treeFileInfo) Sys() any           { return nil }
+
+type treeFile struct {
+	io.ReadCloser
+	info treeFileInfo
+}
+
+func (f *treeFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+type treeDir struct {
+	fsys   *treeFS
+	name   string
+	tree   *object.Tree
+	info   treeFileInfo
+	offset int
+}
+
+func (d *treeDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *treeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *treeDir) Close() error {
+	return nil
+}
+
+func (d *treeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	for d.offset < len(d.tree.Entries) && (n <= 0 || len(entries) < n) {
+		entry := d.tree.Entries[d.offset]
+		d.offset++
+
+		if !d.fsys.visible(path.Join(d.name, entry.Name), entry.Mode == filemode.Dir) {
+			continue
+		}
+		entries = append(entries, &treeDirEntry{tree: d.tree, entry: entry})
+	}
+
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
+
+type treeDirEntry struct {
+	tree  *object.Tree
+	entry object.TreeEntry
+}
+
+func (e *treeDirEntry) Name() string      { return e.entry.Name }
+func (e *treeDirEntry) IsDir() bool       { return e.entry.Mode == filemode.Dir }
+func (e *treeDirEntry) Type() fs.FileMode { return fileMode(e.entry.Mode).Type() }
+
+// Info looks the size of files up in the object storage.
+func (e *treeDirEntry) Info() (fs.FileInfo, error) {
+	info := treeFileInfo{name: e.entry.Name, mode: fileMode(e.entry.Mode)}
+	if e.entry.Mode.IsFile() {
+		file, err := e.tree.TreeEntryFile(&e.entry)
+		if err != nil {
+			return nil, err
+		}
+		info.size = file.Size
+	}
+	return info, nil
+}
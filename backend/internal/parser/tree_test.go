@@ -0,0 +1,35 @@
+package parser_test
+
+import (
+	"context"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"slices"
+	"testing"
+)
+
+func TestParseRepositoryInMemory(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	hash := newTestRepo(t, repoDir, map[string]string{
+		".gitignore":     "*.log\n",
+		"main.go":        "package main\n\nfunc main() {}\n",
+		"docs/README.md": "# Docs\n",
+		"debug.log":      "ignored\n",
+	})
+	p := newTestParser(t, tmpDir, parser.Options{})
+
+	result, err := p.ParseRepository(context.Background(), "file://"+repoDir, parser.ParseOptions{InMemory: true})
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+
+	if result.Revision.Commit != hash.String() {
+		t.Errorf("expected commit %s, got %s", hash, result.Revision.Commit)
+	}
+
+	want := []string{".gitignore", "docs/README.md", "main.go"}
+	if got := parsedFiles(result.Chunks); !slices.Equal(got, want) {
+		t.Errorf("expected files %v, got %v", want, got)
+	}
+}
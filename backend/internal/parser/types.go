@@ -1,6 +1,74 @@
 package parser
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
 type ParsedChunk struct {
-	Content  string
-	FilePath string
+	ID        string
+	Content   string
+	FilePath  string
+	Language  string
+	StartLine int
+	EndLine   int
+	StartByte int
+	EndByte   int
+	// LastCommit is the most recent commit that changed the chunk, if the parse was
+	// asked for the history. Chunks of commits and their diffs carry that commit.
+	LastCommit *CommitInfo
+	// Hunk marks a hunk of the change under review, see ParseOptions.BaseRef. Its lines
+	// are those of the hunk in the new version of the file.
+	Hunk bool
+}
+
+// Location returns the chunk position in the "file.go:120-160" form used for citations.
+// Hunks are marked with a "(diff)" suffix, so they do not clash with the chunks of
+// their file.
+func (c ParsedChunk) Location() string {
+	if c.Hunk {
+		return fmt.Sprintf("%s:%d-%d (diff)", c.FilePath, c.StartLine, c.EndLine)
+	}
+	return fmt.Sprintf("%s:%d-%d", c.FilePath, c.StartLine, c.EndLine)
+}
+
+// chunkID derives a stable identifier from the file path and the chunk content, so the
+// same code in the same file gets the same ID across clones and commits.
+func chunkID(filePath, content string) string {
+	sum := sha256.Sum256([]byte(filePath + "\x00" + content))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Revision identifies the commit a repository was parsed at, so answers can be
+// reproduced later.
+type Revision struct {
+	// URL is the repository URL without any embedded credentials.
+	URL string `json:"url"`
+	// Ref is the requested branch, tag or commit, empty for the default branch.
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+	// BaseRef and BaseCommit are the base of a review, see ParseOptions.BaseRef.
+	BaseRef    string `json:"base_ref,omitempty"`
+	BaseCommit string `json:"base_commit,omitempty"`
+}
+
+// SkippedFile is a file that was left out of a parse because it exceeded a limit.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ParseWarning is a file that could not be parsed, for example because it was not
+// readable. The rest of the repository is parsed regardless.
+type ParseWarning struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+type ParseResult struct {
+	Revision Revision
+	Chunks   map[string]ParsedChunk
+	Skipped  []SkippedFile
+	Warnings []ParseWarning
 }
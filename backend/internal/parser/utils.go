@@ -23,16 +23,7 @@ func (p *Parser) IsTextFile(file *os.File) (bool, error) {
 		return false, err
 	}
 
-	// Check MIME type
-	mimeType := http.DetectContentType(header)
-	isText := false
-	for textType := range p.textMimeTypes {
-		if strings.HasPrefix(mimeType, textType) {
-			isText = true
-			break
-		}
-	}
-	if !isText {
+	if !p.isTextMIME(header) {
 		return false, nil
 	}
 
@@ -55,3 +46,40 @@ func (p *Parser) IsTextFile(file *os.File) (bool, error) {
 	_, err = file.Seek(0, 0)
 	return true, err
 }
+
+// isTextMIME reports whether the MIME type detected from the first 512 bytes of a file
+// is one of the parser's text types.
+func (p *Parser) isTextMIME(header []byte) bool {
+	mimeType := http.DetectContentType(header)
+	for textType := range p.textMimeTypes {
+		if strings.HasPrefix(mimeType, textType) {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidText reports whether content is UTF-8 without replacement characters, the
+// check IsTextFile applies after the MIME type.
+func isValidText(content []byte) bool {
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		if r == utf8.RuneError {
+			return false
+		}
+		content = content[size:]
+	}
+	return true
+}
+
+// lfsPointerVersion starts every Git LFS pointer file.
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/"
+
+// isLFSPointer reports whether content is a Git LFS pointer, which stands in for a
+// file stored outside of the repository. Pointers are at most 1024 bytes long.
+func isLFSPointer(content []byte) bool {
+	return len(content) <= 1024 &&
+		strings.HasPrefix(string(content), lfsPointerVersion) &&
+		strings.Contains(string(content), "\noid sha256:") &&
+		strings.Contains(string(content), "\nsize ")
+}
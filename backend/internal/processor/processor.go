@@ -2,75 +2,221 @@ package processor
 
 import (
 	"context"
+	"fmt"
 	"rankmyrepo/internal/common"
 	"rankmyrepo/internal/completion"
 	"rankmyrepo/internal/parser"
 	"rankmyrepo/internal/ranking"
+	"rankmyrepo/internal/repocache"
+	"sort"
 
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
 )
 
+// maxFusedChunks caps how many chunks of the lexical and hybrid rankers reach the
+// completion, since their scores are relative to the best match rather than absolute.
+const maxFusedChunks = 30
+
+// parseBufferSize is how many parsed chunks may wait for the ranker before the parser
+// pauses the walk.
+const parseBufferSize = 256
+
+// maxReviewHunks and maxReviewHunkBytes cap how many hunks of a review reach the
+// completion. Hunks are not ranked, so without a cap a large diff would put every
+// hunk into the prompt.
+const (
+	maxReviewHunks     = 50
+	maxReviewHunkBytes = 100 << 10
+)
+
+// admitHunks reports the hunks of a review that fit into the caps as ranked and the
+// rest as skipped, and returns the admitted ones. Hunks are admitted in the order of
+// their locations, so the same hunks reach the completion on every run.
+func admitHunks(hunks []ranking.RankedChunk, resultChan chan<- common.QueryResponseChunk) []ranking.RankedChunk {
+	sort.Slice(hunks, func(i, j int) bool {
+		return hunks[i].ParsedChunk.Location() < hunks[j].ParsedChunk.Location()
+	})
+
+	var admitted []ranking.RankedChunk
+	var bytes int
+	for _, hunk := range hunks {
+		size := len(hunk.ParsedChunk.Content)
+		if len(admitted) == maxReviewHunks || bytes+size > maxReviewHunkBytes {
+			resultChan <- common.QueryResponseChunk{
+				Type: common.EventTypeParserSkipped,
+				SkippedFile: &parser.SkippedFile{
+					Path:   hunk.ParsedChunk.Location(),
+					Reason: fmt.Sprintf("review has more than %d hunks or %d bytes of hunks, this hunk was left out of the answer", maxReviewHunks, maxReviewHunkBytes),
+				},
+			}
+			continue
+		}
+
+		admitted = append(admitted, hunk)
+		bytes += size
+		resultChan <- common.QueryResponseChunk{
+			Type:        common.EventTypeRankingRanked,
+			RankedChunk: &hunk,
+		}
+	}
+	return admitted
+}
+
 type Processor struct {
 	parser     *parser.Parser
+	prefilter  *ranking.Prefilter
 	ranker     *ranking.Engine
+	hybrid     *ranking.HybridEngine
 	completion *completion.Completion
 }
 
-func NewProcessor(parser *parser.Parser, ranker *ranking.Engine, compcompletion *completion.Completion) *Processor {
+// NewProcessor wires the pipeline together. prefilter may be nil, in which case every
+// parsed chunk is handed to the ranker.
+func NewProcessor(parser *parser.Parser, prefilter *ranking.Prefilter, ranker *ranking.Engine, hybrid *ranking.HybridEngine, compcompletion *completion.Completion) *Processor {
 	return &Processor{
 		parser:     parser,
+		prefilter:  prefilter,
 		ranker:     ranker,
+		hybrid:     hybrid,
 		completion: compcompletion,
 	}
 }
 
 func (p *Processor) ProcessRankingRequestStream(ctx context.Context, req *ranking.RankingRequest, resultChan chan<- common.QueryResponseChunk) error {
-	parsedChunks, err := p.parser.ParseRepository(ctx, req.RepoPath, req.IgnorePatterns)
-	if err != nil {
-		return err
+	parseOpts := parser.ParseOptions{
+		Ref:              req.Ref,
+		IgnorePatterns:   req.IgnorePatterns,
+		IncludePatterns:  req.IncludePatterns,
+		Languages:        req.Languages,
+		PathPrefix:       req.PathPrefix,
+		NoDefaultIgnores: req.NoDefaultIgnores,
+		CloneMode:        repocache.CloneMode(req.CloneMode),
+		SparsePaths:      req.SparsePaths,
+		Credentials:      req.Credentials,
+		InMemory:         req.InMemory,
+		History:          req.History,
+		SubmoduleDepth:   req.SubmoduleDepth,
+		BaseRef:          req.BaseRef,
 	}
 
-	bufferSize := len(parsedChunks)
-	rankingParsedChan := make(chan parser.ParsedChunk, bufferSize)
-	rankingRankedChan := make(chan ranking.RankedChunk, bufferSize)
-	rankingErrChan := make(chan error, 1)
-
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	revisionChan := make(chan parser.Revision, 1)
+	chunkChan := make(chan parser.ParsedChunk, parseBufferSize)
+	skippedChan := make(chan parser.SkippedFile)
+	warningChan := make(chan parser.ParseWarning)
+	parseErrChan := make(chan error, 1)
+
 	go func() {
-		defer close(rankingParsedChan)
-		defer close(rankingRankedChan)
+		defer close(revisionChan)
+		defer close(chunkChan)
+		defer close(skippedChan)
+		defer close(warningChan)
 
-		if err := p.ranker.RankChunksStream(ctx, req.Query, parsedChunks, req.ScoreThreshold, rankingParsedChan, rankingRankedChan); err != nil {
-			rankingErrChan <- err
-			cancel()
-			return
+		if req.Archive != "" {
+			parseErrChan <- p.parser.ParseArchiveStream(ctx, req.Archive, req.ArchiveName, parseOpts, revisionChan, chunkChan, skippedChan, warningChan)
+		} else {
+			parseErrChan <- p.parser.ParseRepositoryStream(ctx, req.RepoPath, parseOpts, revisionChan, chunkChan, skippedChan, warningChan)
 		}
-		close(rankingErrChan)
 	}()
 
-	var rankedChunks []ranking.RankedChunk
+	revision, ok := <-revisionChan
+	if !ok {
+		return <-parseErrChan
+	}
 
-	for chunk := range rankingParsedChan {
-		resultChan <- common.QueryResponseChunk{
-			Type:        common.EventTypeRankingParsed,
-			ParsedChunk: &chunk,
-		}
+	resultChan <- common.QueryResponseChunk{
+		Type:     common.EventTypeRepositoryResolved,
+		Revision: &revision,
 	}
-	for chunk := range rankingRankedChan {
-		rankedChunks = append(rankedChunks, chunk)
-		resultChan <- common.QueryResponseChunk{
-			Type:        common.EventTypeRankingRanked,
-			RankedChunk: &chunk,
+
+	// Skipped files and warnings are forwarded while the chunks are ranked.
+	parserDone := make(chan struct{})
+	go func() {
+		defer close(parserDone)
+
+		skipped, warnings := skippedChan, warningChan
+		for skipped != nil || warnings != nil {
+			select {
+			case file, ok := <-skipped:
+				if !ok {
+					skipped = nil
+					continue
+				}
+				resultChan <- common.QueryResponseChunk{
+					Type:        common.EventTypeParserSkipped,
+					SkippedFile: &file,
+				}
+			case warning, ok := <-warnings:
+				if !ok {
+					warnings = nil
+					continue
+				}
+				resultChan <- common.QueryResponseChunk{
+					Type:    common.EventTypeParserWarning,
+					Warning: &warning,
+				}
+			}
 		}
+	}()
+	defer func() {
+		cancel()
+		<-parserDone
+	}()
+
+	// The pre-filter and the fused rankers need all chunks before they can rank any, so
+	// only the LLM ranker without a pre-filter ranks chunks while they are parsed.
+	var chunks <-chan parser.ParsedChunk = chunkChan
+	var parsedChunks map[string]parser.ParsedChunk
+	if p.prefilter != nil || req.Ranker != "" && req.Ranker != ranking.RankerLLM {
+		parsedChunks = make(map[string]parser.ParsedChunk)
+		for chunk := range chunkChan {
+			parsedChunks[chunk.Location()] = chunk
+		}
+		if err := <-parseErrChan; err != nil {
+			return err
+		}
+
+		if p.prefilter != nil {
+			var err error
+			parsedChunks, err = p.prefilter.Filter(ctx, req.Query, parsedChunks)
+			if err != nil {
+				return err
+			}
+		}
+		chunks = ranking.ChunkChannel(parsedChunks)
 	}
 
-	if err := <-rankingErrChan; err != nil {
+	var rankedChunks []ranking.RankedChunk
+	var err error
+	switch req.Ranker {
+	case "", ranking.RankerLLM:
+		rankedChunks, err = p.rankStream(ctx, req, chunks, resultChan)
+	case ranking.RankerBM25, ranking.RankerEmbedding:
+		rankedChunks, err = p.rankFused(ctx, req, parsedChunks, map[string]float64{req.Ranker: 1}, resultChan)
+	case ranking.RankerHybrid:
+		rankedChunks, err = p.rankFused(ctx, req, parsedChunks, req.EngineWeights, resultChan)
+	default:
+		err = fmt.Errorf("unknown ranker %q", req.Ranker)
+	}
+	if err != nil {
 		return err
 	}
 
-	stream := p.completion.Run(ctx, req.Query, rankedChunks)
+	if parsedChunks == nil {
+		if err := <-parseErrChan; err != nil {
+			return err
+		}
+	}
+
+	var stream *ssestream.Stream[anthropic.MessageStreamEvent]
+	if req.BaseRef != "" {
+		stream = p.completion.RunReview(ctx, req.Query, revision, rankedChunks)
+	} else {
+		stream = p.completion.Run(ctx, req.Query, rankedChunks)
+	}
 
 	for stream.Next() {
 		event := stream.Current()
@@ -92,3 +238,127 @@ func (p *Processor) ProcessRankingRequestStream(ctx context.Context, req *rankin
 
 	return nil
 }
+
+// rankStream ranks the chunks with the LLM engine as they arrive, forwarding chunks to
+// the client as they are picked up and scored. Hunks of a review are collected and
+// reported by admitHunks once ranking is done, since they arrive in no particular
+// order.
+func (p *Processor) rankStream(ctx context.Context, req *ranking.RankingRequest, parsedChunks <-chan parser.ParsedChunk, resultChan chan<- common.QueryResponseChunk) ([]ranking.RankedChunk, error) {
+	ranker, err := p.ranker.WithProvider(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// rankingParsedChan is unbuffered so a chunk always reaches the client before its score.
+	rankingParsedChan := make(chan parser.ParsedChunk)
+	rankingRankedChan := make(chan ranking.RankedChunk)
+	rankingFailedChan := make(chan ranking.FailedChunk)
+	rankingErrChan := make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		defer close(rankingParsedChan)
+		defer close(rankingRankedChan)
+		defer close(rankingFailedChan)
+
+		if err := ranker.RankChunksStream(ctx, req.Query, parsedChunks, req.ScoreThreshold, rankingParsedChan, rankingRankedChan, rankingFailedChan); err != nil {
+			rankingErrChan <- err
+			cancel()
+			return
+		}
+		close(rankingErrChan)
+	}()
+
+	var rankedChunks, hunks []ranking.RankedChunk
+
+	for rankingParsedChan != nil || rankingRankedChan != nil || rankingFailedChan != nil {
+		select {
+		case chunk, ok := <-rankingParsedChan:
+			if !ok {
+				rankingParsedChan = nil
+				continue
+			}
+			resultChan <- common.QueryResponseChunk{
+				Type:        common.EventTypeRankingParsed,
+				ParsedChunk: &chunk,
+			}
+		case chunk, ok := <-rankingRankedChan:
+			if !ok {
+				rankingRankedChan = nil
+				continue
+			}
+			if chunk.ParsedChunk.Hunk {
+				hunks = append(hunks, chunk)
+				continue
+			}
+			rankedChunks = append(rankedChunks, chunk)
+			resultChan <- common.QueryResponseChunk{
+				Type:        common.EventTypeRankingRanked,
+				RankedChunk: &chunk,
+			}
+		case chunk, ok := <-rankingFailedChan:
+			if !ok {
+				rankingFailedChan = nil
+				continue
+			}
+			resultChan <- common.QueryResponseChunk{
+				Type:        common.EventTypeRankingFailed,
+				FailedChunk: &chunk,
+			}
+		}
+	}
+
+	if err := <-rankingErrChan; err != nil {
+		return nil, err
+	}
+
+	return append(admitHunks(hunks, resultChan), rankedChunks...), nil
+}
+
+// rankFused ranks the chunks with the weighted engines of the hybrid engine and reports
+// the best matches once all engines are done. Hunks of a review are not ranked but
+// reported first through admitHunks.
+func (p *Processor) rankFused(ctx context.Context, req *ranking.RankingRequest, parsedChunks map[string]parser.ParsedChunk, weights map[string]float64, resultChan chan<- common.QueryResponseChunk) ([]ranking.RankedChunk, error) {
+	var hunks []ranking.RankedChunk
+	others := make(map[string]parser.ParsedChunk, len(parsedChunks))
+	for location, chunk := range parsedChunks {
+		resultChan <- common.QueryResponseChunk{
+			Type:        common.EventTypeRankingParsed,
+			ParsedChunk: &chunk,
+		}
+		if chunk.Hunk {
+			hunks = append(hunks, ranking.RankedChunk{ParsedChunk: chunk, Score: 1})
+		} else {
+			others[location] = chunk
+		}
+	}
+	rankedChunks := admitHunks(hunks, resultChan)
+	admitted := len(rankedChunks)
+
+	// The LLM engine of the hybrid engine scores with the provider of the request.
+	ranker, err := p.ranker.WithProvider(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+	hybrid := p.hybrid.WithEngine(ranking.RankerLLM, ranker)
+
+	ranked, err := hybrid.RankChunksWith(ctx, req.Query, others, weights, req.Fusion)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chunk := range ranked {
+		if chunk.Score < req.ScoreThreshold || len(rankedChunks)-admitted == maxFusedChunks {
+			break
+		}
+		rankedChunks = append(rankedChunks, chunk)
+		resultChan <- common.QueryResponseChunk{
+			Type:        common.EventTypeRankingRanked,
+			RankedChunk: &chunk,
+		}
+	}
+
+	return rankedChunks, nil
+}
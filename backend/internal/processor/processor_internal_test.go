@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rankmyrepo/internal/common"
+	"rankmyrepo/internal/parser"
+	"rankmyrepo/internal/ranking"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// unusedProvider fails every call; hunks are never sent to a provider.
+type unusedProvider struct{}
+
+func (unusedProvider) ModelID() string { return "test/unused" }
+
+func (unusedProvider) Complete(ctx context.Context, systemPrompt, prompt string) (ranking.ProviderResponse, error) {
+	return ranking.ProviderResponse{}, errors.New("hunks must not be scored")
+}
+
+func TestRankingCapsReviewHunks(t *testing.T) {
+	engine, err := ranking.NewEngine(map[string]ranking.ScoringProvider{"unused": unusedProvider{}}, "unused", 4, ranking.Options{})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	p := NewProcessor(nil, nil, engine, ranking.NewHybridEngine(map[string]ranking.RankingEngine{ranking.RankerBM25: ranking.NewBM25Engine(1.2, 0.75)}, nil), nil)
+
+	hunks := func(n, size int) map[string]parser.ParsedChunk {
+		chunks := make(map[string]parser.ParsedChunk, n)
+		for i := range n {
+			chunk := parser.ParsedChunk{FilePath: fmt.Sprintf("file%03d.go", i), StartLine: 1, EndLine: 1, Content: strings.Repeat("x", size), Hunk: true}
+			chunks[chunk.Location()] = chunk
+		}
+		return chunks
+	}
+
+	tests := []struct {
+		name   string
+		chunks map[string]parser.ParsedChunk
+		ranked int
+	}{
+		{"within the caps", hunks(3, 10), 3},
+		{"hunk count", hunks(maxReviewHunks+10, 10), maxReviewHunks},
+		{"hunk bytes", hunks(3, maxReviewHunkBytes/2), 2},
+	}
+
+	// Both rankers hand the hunks to the completion without scoring them.
+	type rankFunc func(ctx context.Context, req *ranking.RankingRequest, chunks map[string]parser.ParsedChunk, resultChan chan<- common.QueryResponseChunk) ([]ranking.RankedChunk, error)
+	rankers := map[string]rankFunc{
+		"stream": func(ctx context.Context, req *ranking.RankingRequest, chunks map[string]parser.ParsedChunk, resultChan chan<- common.QueryResponseChunk) ([]ranking.RankedChunk, error) {
+			return p.rankStream(ctx, req, ranking.ChunkChannel(chunks), resultChan)
+		},
+		"fused": func(ctx context.Context, req *ranking.RankingRequest, chunks map[string]parser.ParsedChunk, resultChan chan<- common.QueryResponseChunk) ([]ranking.RankedChunk, error) {
+			return p.rankFused(ctx, req, chunks, map[string]float64{ranking.RankerBM25: 1}, resultChan)
+		},
+	}
+
+	for name, rank := range rankers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				resultChan := make(chan common.QueryResponseChunk, 4*len(tt.chunks))
+				ranked, err := rank(context.Background(), &ranking.RankingRequest{Query: "review"}, tt.chunks, resultChan)
+				if err != nil {
+					t.Fatalf("failed to rank hunks: %v", err)
+				}
+				close(resultChan)
+
+				events := make(map[common.QueryEventType]int)
+				for chunk := range resultChan {
+					events[chunk.Type]++
+				}
+
+				// The hunks that fit are the first by location, however they were ranked.
+				locations := make([]string, 0, len(tt.chunks))
+				for location := range tt.chunks {
+					locations = append(locations, location)
+				}
+				sort.Strings(locations)
+				var got []string
+				for _, chunk := range ranked {
+					got = append(got, chunk.ParsedChunk.Location())
+				}
+				if want := locations[:tt.ranked]; strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Errorf("expected hunks %v to reach the completion, got %v", want, got)
+				}
+				if events[common.EventTypeRankingRanked] != tt.ranked {
+					t.Errorf("expected %d ranked events, got %d", tt.ranked, events[common.EventTypeRankingRanked])
+				}
+				if skipped := len(tt.chunks) - tt.ranked; events[common.EventTypeParserSkipped] != skipped {
+					t.Errorf("expected %d skipped events, got %d", skipped, events[common.EventTypeParserSkipped])
+				}
+			})
+		}
+	}
+}
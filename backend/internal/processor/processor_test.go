@@ -0,0 +1,105 @@
+package processor_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rankmyrepo/internal/common"
+	"rankmyrepo/internal/parser"
+	"rankmyrepo/internal/processor"
+	"rankmyrepo/internal/ranking"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedProvider scores the first chunk at once and holds every later call until the
+// context is done.
+type gatedProvider struct {
+	calls atomic.Int64
+}
+
+func (p *gatedProvider) ModelID() string { return "test/gated" }
+
+func (p *gatedProvider) Complete(ctx context.Context, systemPrompt, prompt string) (ranking.ProviderResponse, error) {
+	if p.calls.Add(1) == 1 {
+		return ranking.ProviderResponse{Content: "<score>0.9</score>"}, nil
+	}
+	<-ctx.Done()
+	return ranking.ProviderResponse{}, ctx.Err()
+}
+
+func TestProcessRankingRequestStreamRanksWhileParsing(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// While the provider holds its calls, the ranker takes at most one chunk per worker
+	// plus the one it scored, and the parse buffer holds the rest. With more files than
+	// that, the walk cannot reach last.txt, which is skipped for its size, until ranking
+	// moves on.
+	const workers = 2
+	const files = 300
+	for i := range files {
+		name := filepath.Join(tmpDir, fmt.Sprintf("file%03d.txt", i))
+		if err := os.WriteFile(name, []byte(fmt.Sprintf("content of file %d\n", i)), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "last.txt"), []byte(strings.Repeat("too large\n", 100)), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	p, err := parser.NewParser(map[string]bool{"text/": true}, parser.Options{
+		LocalRoots: []string{tmpDir},
+		Limits:     parser.Limits{MaxFileBytes: 100},
+	})
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	defer p.Cleanup()
+
+	engine, err := ranking.NewEngine(map[string]ranking.ScoringProvider{"gated": &gatedProvider{}}, "gated", workers, ranking.Options{})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+
+	// The default configuration has no pre-filter and ranks with the LLM engine.
+	proc := processor.NewProcessor(p, nil, engine, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resultChan := make(chan common.QueryResponseChunk)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(resultChan)
+		errChan <- proc.ProcessRankingRequestStream(ctx, &ranking.RankingRequest{RepoPath: tmpDir, Query: "files"}, resultChan)
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for ranked := false; !ranked; {
+		select {
+		case chunk, ok := <-resultChan:
+			if !ok {
+				t.Fatalf("expected a score before the stream ended: %v", <-errChan)
+			}
+			switch chunk.Type {
+			case common.EventTypeParserSkipped:
+				t.Fatalf("expected a score before the walk reached %s", chunk.SkippedFile.Path)
+			case common.EventTypeRankingRanked:
+				ranked = true
+			}
+		case <-timeout:
+			t.Fatal("expected a score while the repository is walked")
+		}
+	}
+
+	// Cancelling the request stops ranking before the completion is asked for.
+	cancel()
+	for range resultChan {
+	}
+	if err := <-errChan; err == nil {
+		t.Error("expected the cancelled request to fail")
+	}
+}
@@ -0,0 +1,104 @@
+package ranking
+
+import (
+	"context"
+	"math"
+	"rankmyrepo/internal/parser"
+)
+
+// BM25Engine is a lexical ranking engine based on Okapi BM25 over code-aware tokens.
+// It runs entirely in process, so it can rank offline or serve as a cheap first stage
+// ahead of the LLM engine. Scores are normalized so the best chunk scores 1.0.
+type BM25Engine struct {
+	k1 float64
+	b  float64
+}
+
+func NewBM25Engine(k1, b float64) *BM25Engine {
+	return &BM25Engine{
+		k1: k1,
+		b:  b,
+	}
+}
+
+func (e *BM25Engine) RankChunks(ctx context.Context, query string, chunks map[string]parser.ParsedChunk) ([]RankedChunk, error) {
+	queryTerms := uniqueTerms(tokenize(query))
+
+	type document struct {
+		chunk  parser.ParsedChunk
+		terms  map[string]int
+		length int
+	}
+
+	var (
+		documents   = make([]document, 0, len(chunks))
+		docFreq     = make(map[string]int)
+		totalLength int
+	)
+	for _, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		tokens := tokenize(chunk.FilePath + "\n" + chunk.Content)
+		terms := make(map[string]int)
+		for _, token := range tokens {
+			terms[token]++
+		}
+		for _, term := range queryTerms {
+			if terms[term] > 0 {
+				docFreq[term]++
+			}
+		}
+
+		documents = append(documents, document{chunk: chunk, terms: terms, length: len(tokens)})
+		totalLength += len(tokens)
+	}
+
+	if len(documents) == 0 {
+		return nil, nil
+	}
+
+	avgLength := float64(totalLength) / float64(len(documents))
+	n := float64(len(documents))
+
+	ranked := make([]RankedChunk, 0, len(documents))
+	var maxScore float64
+	for _, doc := range documents {
+		var score float64
+		for _, term := range queryTerms {
+			tf := float64(doc.terms[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (e.k1 + 1) / (tf + e.k1*(1-e.b+e.b*float64(doc.length)/avgLength))
+		}
+
+		maxScore = math.Max(maxScore, score)
+		ranked = append(ranked, RankedChunk{ParsedChunk: doc.chunk, Score: score})
+	}
+
+	if maxScore > 0 {
+		for i := range ranked {
+			ranked[i].Score /= maxScore
+		}
+	}
+
+	sortRanked(ranked)
+
+	return ranked, nil
+}
+
+func uniqueTerms(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	var terms []string
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
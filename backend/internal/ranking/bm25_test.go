@@ -0,0 +1,63 @@
+package ranking
+
+import (
+	"context"
+	"rankmyrepo/internal/parser"
+	"testing"
+)
+
+func TestBM25EngineRanksLexicalMatches(t *testing.T) {
+	chunks := map[string]parser.ParsedChunk{
+		"retry.go:1-3": {FilePath: "retry.go", StartLine: 1, EndLine: 3, Content: "func retryRequest() {\n\tbackoff()\n}"},
+		"log.go:1-3":   {FilePath: "log.go", StartLine: 1, EndLine: 3, Content: "func logRequest() {\n\tprintln()\n}"},
+		"math.go:1-3":  {FilePath: "math.go", StartLine: 1, EndLine: 3, Content: "func add(a, b int) int {\n\treturn a + b\n}"},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"identifier parts", "how does the request retry work?", []string{"retry.go:1-3", "log.go:1-3", "math.go:1-3"}},
+		{"file path", "what is in math.go", []string{"math.go:1-3", "log.go:1-3", "retry.go:1-3"}},
+		{"no match", "kubernetes", []string{"log.go:1-3", "math.go:1-3", "retry.go:1-3"}},
+	}
+
+	engine := NewBM25Engine(1.2, 0.75)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked, err := engine.RankChunks(context.Background(), tt.query, chunks)
+			if err != nil {
+				t.Fatalf("failed to rank chunks: %v", err)
+			}
+			if len(ranked) != len(tt.want) {
+				t.Fatalf("expected %d chunks, got %d", len(tt.want), len(ranked))
+			}
+			for i, location := range tt.want {
+				if got := ranked[i].ParsedChunk.Location(); got != location {
+					t.Errorf("expected %s at rank %d, got %s", location, i+1, got)
+				}
+			}
+			if ranked[0].Score > 1 {
+				t.Errorf("expected scores to be normalized to 1, got %v", ranked[0].Score)
+			}
+		})
+	}
+}
+
+func TestBM25EngineFavoursRareTerms(t *testing.T) {
+	// "request" appears in every chunk, so the rare "cache" decides the ranking.
+	chunks := map[string]parser.ParsedChunk{
+		"a.go:1-1": {FilePath: "a.go", StartLine: 1, EndLine: 1, Content: "request request request"},
+		"b.go:1-1": {FilePath: "b.go", StartLine: 1, EndLine: 1, Content: "request cache"},
+		"c.go:1-1": {FilePath: "c.go", StartLine: 1, EndLine: 1, Content: "request"},
+	}
+
+	ranked, err := NewBM25Engine(1.2, 0.75).RankChunks(context.Background(), "request cache", chunks)
+	if err != nil {
+		t.Fatalf("failed to rank chunks: %v", err)
+	}
+	if ranked[0].ParsedChunk.FilePath != "b.go" || ranked[0].Score != 1 {
+		t.Errorf("expected b.go to rank first with score 1, got %s with %v", ranked[0].ParsedChunk.FilePath, ranked[0].Score)
+	}
+}
@@ -0,0 +1,180 @@
+package ranking
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ScoreCache stores relevance scores so identical (query, chunk, model) combinations
+// are only ranked once.
+type ScoreCache interface {
+	Get(key string) (float64, bool)
+	Set(key string, score float64)
+}
+
+// ScoreCacheKey builds the cache key for a score. Queries are compared after trimming
+// surrounding whitespace; the chunk is identified by its content hash ID.
+func ScoreCacheKey(query, chunkID, modelID string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(query) + "\x00" + chunkID + "\x00" + modelID))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryScoreCache is an in-memory LRU score cache holding at most capacity entries.
+type MemoryScoreCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type memoryEntry struct {
+	key   string
+	score float64
+}
+
+func NewMemoryScoreCache(capacity int) *MemoryScoreCache {
+	return &MemoryScoreCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *MemoryScoreCache) Get(key string) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*memoryEntry).score, true
+}
+
+func (c *MemoryScoreCache) Set(key string, score float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*memoryEntry).score = score
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, score: score})
+
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// FileScoreCache persists scores as JSON lines in a single append-only file, so they
+// survive restarts. All entries are loaded into memory when the cache is opened.
+type FileScoreCache struct {
+	mu     sync.Mutex
+	file   *os.File
+	scores map[string]float64
+}
+
+type fileEntry struct {
+	Key   string  `json:"key"`
+	Score float64 `json:"score"`
+}
+
+func NewFileScoreCache(path string) (*FileScoreCache, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open score cache: %w", err)
+	}
+
+	scores := make(map[string]float64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry fileEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		scores[entry.Key] = entry.Score
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read score cache: %w", err)
+	}
+
+	return &FileScoreCache{
+		file:   file,
+		scores: scores,
+	}, nil
+}
+
+func (c *FileScoreCache) Get(key string) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	score, ok := c.scores[key]
+	return score, ok
+}
+
+func (c *FileScoreCache) Set(key string, score float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.scores[key]; ok && existing == score {
+		return
+	}
+	c.scores[key] = score
+
+	data, err := json.Marshal(fileEntry{Key: key, Score: score})
+	if err != nil {
+		return
+	}
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		log.Printf("failed to persist score: %v", err)
+	}
+}
+
+func (c *FileScoreCache) Close() error {
+	return c.file.Close()
+}
+
+// TieredScoreCache looks scores up in each cache in order, copying hits into the
+// faster caches in front of it, and writes new scores to all of them.
+type TieredScoreCache struct {
+	caches []ScoreCache
+}
+
+func NewTieredScoreCache(caches ...ScoreCache) *TieredScoreCache {
+	return &TieredScoreCache{
+		caches: caches,
+	}
+}
+
+func (c *TieredScoreCache) Get(key string) (float64, bool) {
+	for i, cache := range c.caches {
+		if score, ok := cache.Get(key); ok {
+			for _, faster := range c.caches[:i] {
+				faster.Set(key, score)
+			}
+			return score, true
+		}
+	}
+	return 0, false
+}
+
+func (c *TieredScoreCache) Set(key string, score float64) {
+	for _, cache := range c.caches {
+		cache.Set(key, score)
+	}
+}
@@ -0,0 +1,165 @@
+package ranking
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"rankmyrepo/internal/parser"
+	"testing"
+)
+
+func TestScoreCacheKey(t *testing.T) {
+	base := ScoreCacheKey("how are retries done?", "chunk", "fake/model")
+
+	tests := []struct {
+		name             string
+		query, id, model string
+		same             bool
+	}{
+		{"identical", "how are retries done?", "chunk", "fake/model", true},
+		{"surrounding whitespace", "  how are retries done?\n", "chunk", "fake/model", true},
+		{"other query", "how are errors logged?", "chunk", "fake/model", false},
+		{"other chunk", "how are retries done?", "other", "fake/model", false},
+		{"other model", "how are retries done?", "chunk", "fake/other", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := ScoreCacheKey(tt.query, tt.id, tt.model) == base; same != tt.same {
+				t.Errorf("expected same key to be %v, got %v", tt.same, same)
+			}
+		})
+	}
+}
+
+func TestMemoryScoreCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewMemoryScoreCache(2)
+	cache.Set("a", 0.1)
+	cache.Set("b", 0.2)
+	cache.Get("a")
+	cache.Set("c", 0.3)
+
+	tests := []struct {
+		key   string
+		score float64
+		ok    bool
+	}{
+		{"a", 0.1, true},
+		{"b", 0, false},
+		{"c", 0.3, true},
+	}
+	for _, tt := range tests {
+		if score, ok := cache.Get(tt.key); score != tt.score || ok != tt.ok {
+			t.Errorf("Get(%q) = %v, %v, want %v, %v", tt.key, score, ok, tt.score, tt.ok)
+		}
+	}
+}
+
+func TestFileScoreCachePersistsScores(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.jsonl")
+
+	cache, err := NewFileScoreCache(path)
+	if err != nil {
+		t.Fatalf("failed to open score cache: %v", err)
+	}
+	cache.Set("a", 0.5)
+	cache.Set("a", 0.7)
+	cache.Set("b", 0.2)
+	cache.Close()
+
+	// Corrupt lines, e.g. of a write cut short by a crash, are skipped.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open score cache file: %v", err)
+	}
+	file.WriteString("{\"key\": \"c\", \"sco\n")
+	file.Close()
+
+	cache, err = NewFileScoreCache(path)
+	if err != nil {
+		t.Fatalf("failed to reopen score cache: %v", err)
+	}
+	defer cache.Close()
+
+	tests := []struct {
+		key   string
+		score float64
+		ok    bool
+	}{
+		{"a", 0.7, true},
+		{"b", 0.2, true},
+		{"c", 0, false},
+	}
+	for _, tt := range tests {
+		if score, ok := cache.Get(tt.key); score != tt.score || ok != tt.ok {
+			t.Errorf("Get(%q) = %v, %v, want %v, %v", tt.key, score, ok, tt.score, tt.ok)
+		}
+	}
+}
+
+func TestTieredScoreCacheCopiesHitsForward(t *testing.T) {
+	memory := NewMemoryScoreCache(10)
+	slow := NewMemoryScoreCache(10)
+	slow.Set("a", 0.4)
+
+	cache := NewTieredScoreCache(memory, slow)
+	if score, ok := cache.Get("a"); !ok || score != 0.4 {
+		t.Fatalf("expected a hit in the slow cache, got %v, %v", score, ok)
+	}
+	if score, ok := memory.Get("a"); !ok || score != 0.4 {
+		t.Errorf("expected the hit to be copied into memory, got %v, %v", score, ok)
+	}
+
+	cache.Set("b", 0.9)
+	if _, ok := slow.Get("b"); !ok {
+		t.Error("expected new scores to be written to every cache")
+	}
+}
+
+func TestEngineScoresCachedChunksOnce(t *testing.T) {
+	fast := scoreProvider("fast", "0.8")
+	other := scoreProvider("other", "0.3")
+	engine := newTestEngine(t, map[string]ScoringProvider{"fast": fast, "other": other}, Options{
+		ScoreCache: NewMemoryScoreCache(10),
+	})
+
+	chunks := map[string]parser.ParsedChunk{
+		"a.go:1-2": {ID: "a", FilePath: "a.go", StartLine: 1, EndLine: 2, Content: "package a"},
+		"b.go:1-2": {ID: "b", FilePath: "b.go", StartLine: 1, EndLine: 2, Content: "package b"},
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		query    string
+		calls    int64
+	}{
+		{"first query", "fast", "what does a do?", 2},
+		{"same query", "fast", "what does a do? ", 2},
+		{"other query", "fast", "what does b do?", 4},
+		{"other model", "other", "what does a do?", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranker, err := engine.WithProvider(tt.provider)
+			if err != nil {
+				t.Fatalf("failed to select provider: %v", err)
+			}
+			ranked, err := ranker.RankChunks(context.Background(), tt.query, chunks)
+			if err != nil {
+				t.Fatalf("failed to rank chunks: %v", err)
+			}
+			if len(ranked) != len(chunks) {
+				t.Errorf("expected %d ranked chunks, got %d", len(chunks), len(ranked))
+			}
+
+			provider := fast
+			if tt.provider == "other" {
+				provider = other
+			}
+			if calls := provider.calls.Load(); calls != tt.calls {
+				t.Errorf("expected %d provider calls in total, got %d", tt.calls, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package ranking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"rankmyrepo/internal/parser"
+	"sort"
+	"unicode/utf8"
+)
+
+// maxEmbeddingInput caps the number of bytes of a chunk that are sent to an embedder.
+const maxEmbeddingInput = 8000
+
+// Embedder turns texts into vectors whose cosine similarity reflects how related the
+// texts are. Implementations must return one vector per text, in order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// HashEmbedder is a local, deterministic embedder based on feature hashing of code
+// tokens. It needs no network access, which makes it the default for development
+// and tests.
+type HashEmbedder struct {
+	dimensions int
+}
+
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	return &HashEmbedder{
+		dimensions: dimensions,
+	}
+}
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.dimensions)
+		for _, token := range tokenize(text) {
+			h := fnv.New64a()
+			h.Write([]byte(token))
+			sum := h.Sum64()
+
+			sign := float32(1)
+			if sum>>63 == 1 {
+				sign = -1
+			}
+			vector[sum%uint64(e.dimensions)] += sign
+		}
+		vectors[i] = normalize(vector)
+	}
+	return vectors, nil
+}
+
+// OpenAIEmbedder calls an OpenAI-compatible /embeddings endpoint, such as the ones
+// offered by OpenAI or Fireworks.
+type OpenAIEmbedder struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+func NewOpenAIEmbedder(baseURL, apiKey, model string) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{},
+	}
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := postJSON(ctx, e.client, e.baseURL+"/embeddings", e.apiKey, struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{
+		Model: e.model,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range response.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = normalize(d.Embedding)
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+
+	return vectors, nil
+}
+
+// EmbeddingEngine ranks chunks by the cosine similarity between their embedding and
+// the embedding of the query.
+type EmbeddingEngine struct {
+	embedder  Embedder
+	batchSize int
+}
+
+func NewEmbeddingEngine(embedder Embedder, batchSize int) *EmbeddingEngine {
+	return &EmbeddingEngine{
+		embedder:  embedder,
+		batchSize: batchSize,
+	}
+}
+
+func (e *EmbeddingEngine) RankChunks(ctx context.Context, query string, chunks map[string]parser.ParsedChunk) ([]RankedChunk, error) {
+	queryVectors, err := e.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	queryVector := queryVectors[0]
+
+	ordered := make([]parser.ParsedChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		ordered = append(ordered, chunk)
+	}
+
+	ranked := make([]RankedChunk, 0, len(ordered))
+	for start := 0; start < len(ordered); start += e.batchSize {
+		batch := ordered[start:min(start+e.batchSize, len(ordered))]
+
+		texts := make([]string, len(batch))
+		for i, chunk := range batch {
+			texts[i] = embeddingInput(chunk)
+		}
+
+		vectors, err := e.embedder.Embed(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed chunks: %w", err)
+		}
+
+		for i, chunk := range batch {
+			ranked = append(ranked, RankedChunk{
+				ParsedChunk: chunk,
+				Score:       cosine(queryVector, vectors[i]),
+			})
+		}
+	}
+
+	sortRanked(ranked)
+
+	return ranked, nil
+}
+
+func embeddingInput(chunk parser.ParsedChunk) string {
+	content := chunk.Content
+	if len(content) > maxEmbeddingInput {
+		// Cut at a rune boundary, so the input stays valid UTF-8.
+		end := maxEmbeddingInput
+		for end > 0 && !utf8.RuneStart(content[end]) {
+			end--
+		}
+		content = content[:end]
+	}
+	return chunk.FilePath + "\n" + content
+}
+
+// sortRanked orders chunks by descending score, breaking ties by location so the
+// order is deterministic.
+func sortRanked(ranked []RankedChunk) {
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].ParsedChunk.Location() < ranked[j].ParsedChunk.Location()
+	})
+}
+
+func normalize(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+// cosine returns the cosine similarity of two normalized vectors.
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
@@ -0,0 +1,33 @@
+package ranking
+
+import (
+	"rankmyrepo/internal/parser"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEmbeddingInputKeepsValidUTF8(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{"short", "héllo", len("main.go\nhéllo")},
+		{"ascii cut", strings.Repeat("a", maxEmbeddingInput+10), len("main.go\n") + maxEmbeddingInput},
+		// "世" is three bytes long, so the limit falls inside the last rune.
+		{"rune cut", "a" + strings.Repeat("世", maxEmbeddingInput/3+1), len("main.go\n") + maxEmbeddingInput - 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := embeddingInput(parser.ParsedChunk{FilePath: "main.go", Content: tt.content})
+			if !utf8.ValidString(input) {
+				t.Errorf("expected valid UTF-8, got %q", input[len(input)-4:])
+			}
+			if len(input) != tt.want {
+				t.Errorf("expected %d bytes, got %d", tt.want, len(input))
+			}
+		})
+	}
+}
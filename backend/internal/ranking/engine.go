@@ -1,179 +1,199 @@
 package ranking
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
 	"rankmyrepo/internal/parser"
 	"sync"
-
-	"github.com/replicate/replicate-go"
 )
 
 type Engine struct {
-	r8         *replicate.Client
+	providers  map[string]ScoringProvider
+	provider   ScoringProvider
 	maxWorkers int
+	scoreCache ScoreCache
+	usage      *usageTracker
+	retry      RetryPolicy
+	limiter    *RateLimiter
+	onFailure  FailurePolicy
 }
 
-func NewEngine(r8 *replicate.Client, maxWorkers int) *Engine {
-	return &Engine{
-		r8:         r8,
-		maxWorkers: maxWorkers,
-	}
+// FailurePolicy decides what happens to a query when a chunk cannot be scored after
+// all retries.
+type FailurePolicy string
+
+const (
+	// FailurePolicyFail aborts the whole query with the chunk's error.
+	FailurePolicyFail FailurePolicy = "fail"
+	// FailurePolicyReport reports the chunk as failed and keeps ranking the remaining
+	// chunks.
+	FailurePolicyReport FailurePolicy = "report"
+)
+
+type usageTracker struct {
+	mu    sync.Mutex
+	total Usage
 }
 
-func (e *Engine) RankSingleChunkReplicate(ctx context.Context, query string, chunk parser.ParsedChunk) (float64, error) {
-	prompt := buildRankingPrompt(query, chunk)
+type Options struct {
+	// ScoreCache short-circuits ranking calls for chunks that were already scored
+	// for the same query and model.
+	ScoreCache ScoreCache
+	// Retry defaults to DefaultRetryPolicy.
+	Retry *RetryPolicy
+	// RateLimiter, if set, caps the rate of provider calls across all queries.
+	RateLimiter *RateLimiter
+	// FailurePolicy defaults to FailurePolicyFail.
+	FailurePolicy FailurePolicy
+}
 
-	model := "meta/meta-llama-3-8b-instruct"
+// NewEngine returns an engine scoring chunks with the named default provider. The other
+// providers can be selected per request through WithProvider.
+func NewEngine(providers map[string]ScoringProvider, defaultProvider string, maxWorkers int, opts Options) (*Engine, error) {
+	provider, ok := providers[defaultProvider]
+	if !ok {
+		return nil, fmt.Errorf("unknown scoring provider %q", defaultProvider)
+	}
 
-	input := replicate.PredictionInput{
-		"prompt":       prompt,
-		"system_prompt": systemPrompt,
-		"temperature": 0.1,
+	retry := DefaultRetryPolicy
+	if opts.Retry != nil {
+		retry = *opts.Retry
 	}
 
-	output, err := e.r8.Run(ctx, model, input, nil)
-	if err != nil {
-		return 0, fmt.Errorf("failed to run model: %w", err)
+	onFailure := opts.FailurePolicy
+	switch onFailure {
+	case "":
+		onFailure = FailurePolicyFail
+	case FailurePolicyFail, FailurePolicyReport:
+	default:
+		return nil, fmt.Errorf("unknown failure policy %q", onFailure)
 	}
 
-	tokens, ok := output.([]interface{})
-	if !ok {
-		return 0, fmt.Errorf("unexpected output type from model: got %T, want []interface{}", output)
+	return &Engine{
+		providers:  providers,
+		provider:   provider,
+		maxWorkers: maxWorkers,
+		scoreCache: opts.ScoreCache,
+		usage:      &usageTracker{},
+		retry:      retry,
+		limiter:    opts.RateLimiter,
+		onFailure:  onFailure,
+	}, nil
+}
+
+// WithProvider returns a copy of the engine that scores with the named provider. An
+// empty name keeps the current provider.
+func (e *Engine) WithProvider(name string) (*Engine, error) {
+	if name == "" {
+		return e, nil
 	}
 
-	var result string
-	for _, token := range tokens {
-		if str, ok := token.(string); ok {
-			result += str
-		}
+	provider, ok := e.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scoring provider %q", name)
 	}
 
-	return parseScore(result)
+	engine := *e
+	engine.provider = provider
+	return &engine, nil
 }
 
-func (e *Engine) RankSingleChunkFireworks(ctx context.Context, query string, chunk parser.ParsedChunk) (float64, error) {
+// RankSingleChunk scores a single chunk and reports the tokens the call consumed. A
+// truncated reply is accepted as long as it still contains a complete score.
+func (e *Engine) RankSingleChunk(ctx context.Context, query string, chunk parser.ParsedChunk) (float64, Usage, error) {
 	prompt := buildRankingPrompt(query, chunk)
 
-	requestBody := struct {
-		Model            string `json:"model"`
-		TopP            float64 `json:"top_p"`
-		TopK            int     `json:"top_k"`
-		PresencePenalty float64 `json:"presence_penalty"`
-		FrequencyPenalty float64 `json:"frequency_penalty"`
-		Temperature     float64 `json:"temperature"`
-		Messages        []struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"messages"`
-	}{
-		Model:            "accounts/fireworks/models/llama-v3p2-3b-instruct",
-		PresencePenalty:  0,
-		FrequencyPenalty: 0,
-		Temperature:     0.1,
-		Messages: []struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		}{
-			{
-				Role:    "system",
-				Content: systemPrompt,
-			},
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return 0, fmt.Errorf("marshaling request body: %w", err)
-	}
+	var response ProviderResponse
+	err := e.retry.Do(ctx, func() error {
+		if e.limiter != nil {
+			if err := e.limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
 
-	req, err := http.NewRequest("POST", "https://api.fireworks.ai/inference/v1/chat/completions", bytes.NewBuffer(jsonData))
+		var err error
+		response, err = e.provider.Complete(ctx, systemPrompt, prompt)
+		e.recordUsage(response.Usage)
+		return err
+	})
 	if err != nil {
-		return 0, fmt.Errorf("creating request: %w", err)
+		var truncated *TruncationError
+		if !errors.As(err, &truncated) {
+			return 0, response.Usage, err
+		}
+		if score, parseErr := parseScore(truncated.Content); parseErr == nil {
+			return score, response.Usage, nil
+		}
+		return 0, response.Usage, err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+os.Getenv("FIREWORKS_API_KEY"))
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+	score, err := parseScore(response.Content)
+	return score, response.Usage, err
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, fmt.Errorf("making request: %w", err)
-	}
-	defer resp.Body.Close()
+// Usage returns the tokens consumed by all ranking calls since the engine was created.
+func (e *Engine) Usage() Usage {
+	e.usage.mu.Lock()
+	defer e.usage.mu.Unlock()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
+	return e.usage.total
+}
 
-	body, _ := io.ReadAll(resp.Body)
+func (e *Engine) recordUsage(usage Usage) {
+	e.usage.mu.Lock()
+	defer e.usage.mu.Unlock()
 
-	return parseScore(string(body))
+	e.usage.total = e.usage.total.Add(usage)
 }
 
+// RankChunksStream scores the chunks received from chunks concurrently until the channel
+// is closed, so ranking can start before all chunks are known. Every chunk is sent to
+// parsedChan when its scoring starts and to rankedChan if it reaches scoreThreshold.
+// Chunks that cannot be scored are sent to failedChan under FailurePolicyReport; under
+// FailurePolicyFail the first failure aborts ranking and is returned.
+func (e *Engine) RankChunksStream(ctx context.Context, query string, chunks <-chan parser.ParsedChunk, scoreThreshold float64, parsedChan chan<- parser.ParsedChunk, rankedChan chan<- RankedChunk, failedChan chan<- FailedChunk) error {
+	log.Printf("Starting to rank chunks for query: %s", query)
 
-func (e *Engine) RankChunksStream(ctx context.Context, query string, chunks map[string]parser.ParsedChunk, scoreThreshold float64, parsedChan chan<- parser.ParsedChunk, rankedChan chan<- RankedChunk) error {
-	log.Printf("Starting to rank %d chunks for query: %s", len(chunks), query)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	errors := make(chan error, len(chunks))
-	sem := make(chan struct{}, e.maxWorkers)
+	// Every worker reports at most one error.
+	errors := make(chan error, e.maxWorkers)
 
 	var wg sync.WaitGroup
-	for _, chunk := range chunks {
+	for range e.maxWorkers {
 		wg.Add(1)
-		go func(c parser.ParsedChunk) {
+		go func() {
 			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			select {
-			case parsedChan <- c:
-			case <-ctx.Done():
-				errors <- ctx.Err()
-				return
-			}
-
-			score, err := e.RankSingleChunkFireworks(ctx, query, c)
-
-			log.Printf("Score: %f", score)
-
-			if err != nil {
-				errors <- err
-				return
-			}
 
-			if score >= scoreThreshold {
-				ranked := RankedChunk{
-					ParsedChunk: c,
-					Score:       score,
-				}
+			for {
+				var c parser.ParsedChunk
+				var ok bool
 				select {
-				case rankedChan <- ranked:
+				case c, ok = <-chunks:
+					if !ok {
+						return
+					}
 				case <-ctx.Done():
 					errors <- ctx.Err()
 					return
 				}
+
+				if err := e.rankChunk(ctx, query, c, scoreThreshold, parsedChan, rankedChan, failedChan); err != nil {
+					errors <- err
+					cancel()
+					return
+				}
 			}
-		}(chunk)
+		}()
 	}
 
-	go func() {
-		wg.Wait()
-		close(errors)
-	}()
+	wg.Wait()
+	close(errors)
 
+	// The first error is the one that cancelled the other workers.
 	for err := range errors {
 		if err != nil {
 			return err
@@ -182,3 +202,106 @@ func (e *Engine) RankChunksStream(ctx context.Context, query string, chunks map[
 
 	return nil
 }
+
+// rankChunk scores a single chunk for RankChunksStream. It only returns an error when
+// ranking has to stop.
+func (e *Engine) rankChunk(ctx context.Context, query string, c parser.ParsedChunk, scoreThreshold float64, parsedChan chan<- parser.ParsedChunk, rankedChan chan<- RankedChunk, failedChan chan<- FailedChunk) error {
+	select {
+	case parsedChan <- c:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	score, usage, err := e.scoreChunk(ctx, query, c)
+	if err != nil {
+		if e.onFailure != FailurePolicyReport || ctx.Err() != nil {
+			return err
+		}
+
+		log.Printf("Failed to score %s: %v", c.Location(), err)
+		select {
+		case failedChan <- FailedChunk{ParsedChunk: c, Reason: err.Error()}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	if score >= scoreThreshold {
+		ranked := RankedChunk{
+			ParsedChunk: c,
+			Score:       score,
+			Usage:       usage,
+		}
+		select {
+		case rankedChan <- ranked:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// scoreChunk returns the cached score of the chunk for the query, ranking it with the
+// provider on a cache miss. Cached scores cost no tokens. Hunks of a review always get
+// the top score without asking the provider, since the question is about them.
+func (e *Engine) scoreChunk(ctx context.Context, query string, chunk parser.ParsedChunk) (float64, Usage, error) {
+	if chunk.Hunk {
+		return 1, Usage{}, nil
+	}
+
+	var key string
+	if e.scoreCache != nil {
+		key = ScoreCacheKey(query, chunk.ID, e.provider.ModelID())
+		if score, ok := e.scoreCache.Get(key); ok {
+			return score, Usage{}, nil
+		}
+	}
+
+	score, usage, err := e.RankSingleChunk(ctx, query, chunk)
+	if err != nil {
+		return 0, usage, err
+	}
+
+	log.Printf("Score: %f (%d tokens)", score, usage.TotalTokens)
+
+	if e.scoreCache != nil {
+		e.scoreCache.Set(key, score)
+	}
+
+	return score, usage, nil
+}
+
+// RankChunks implements RankingEngine by scoring every chunk and returning them sorted
+// by descending score. Chunks that fail under FailurePolicyReport are left out.
+func (e *Engine) RankChunks(ctx context.Context, query string, chunks map[string]parser.ParsedChunk) ([]RankedChunk, error) {
+	parsedChan := make(chan parser.ParsedChunk, len(chunks))
+	rankedChan := make(chan RankedChunk, len(chunks))
+	failedChan := make(chan FailedChunk, len(chunks))
+
+	if err := e.RankChunksStream(ctx, query, ChunkChannel(chunks), 0, parsedChan, rankedChan, failedChan); err != nil {
+		return nil, err
+	}
+	close(rankedChan)
+
+	ranked := make([]RankedChunk, 0, len(chunks))
+	for chunk := range rankedChan {
+		ranked = append(ranked, chunk)
+	}
+
+	sortRanked(ranked)
+
+	return ranked, nil
+}
+
+// ChunkChannel returns a closed channel holding the chunks, for handing chunks that are
+// already known to RankChunksStream.
+func ChunkChannel(chunks map[string]parser.ParsedChunk) <-chan parser.ParsedChunk {
+	ch := make(chan parser.ParsedChunk, len(chunks))
+	for _, chunk := range chunks {
+		ch <- chunk
+	}
+	close(ch)
+	return ch
+}
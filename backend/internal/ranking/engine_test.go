@@ -0,0 +1,129 @@
+package ranking
+
+import (
+	"context"
+	"net/http"
+	"rankmyrepo/internal/parser"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider answers ranking calls with complete and counts them.
+type fakeProvider struct {
+	model    string
+	calls    atomic.Int64
+	complete func(prompt string) (ProviderResponse, error)
+}
+
+func (p *fakeProvider) ModelID() string {
+	return "fake/" + p.model
+}
+
+func (p *fakeProvider) Complete(ctx context.Context, systemPrompt, prompt string) (ProviderResponse, error) {
+	p.calls.Add(1)
+	return p.complete(prompt)
+}
+
+// scoreProvider returns a provider that scores every chunk with score.
+func scoreProvider(model, score string) *fakeProvider {
+	return &fakeProvider{
+		model: model,
+		complete: func(string) (ProviderResponse, error) {
+			return ProviderResponse{Content: "<score>" + score + "</score>", Usage: Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}}, nil
+		},
+	}
+}
+
+// testRetryPolicy retries like the default policy without making tests wait.
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func newTestEngine(t *testing.T, providers map[string]ScoringProvider, opts Options) *Engine {
+	t.Helper()
+
+	if opts.Retry == nil {
+		opts.Retry = &testRetryPolicy
+	}
+	var defaultProvider string
+	for name := range providers {
+		if defaultProvider == "" || name < defaultProvider {
+			defaultProvider = name
+		}
+	}
+
+	engine, err := NewEngine(providers, defaultProvider, 4, opts)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	return engine
+}
+
+func TestRankChunksStreamFailurePolicies(t *testing.T) {
+	// Chunks of broken.go always fail, the others are scored.
+	provider := &fakeProvider{complete: func(prompt string) (ProviderResponse, error) {
+		if strings.Contains(prompt, "broken.go") {
+			return ProviderResponse{}, &StatusError{StatusCode: http.StatusBadRequest, Body: "bad chunk"}
+		}
+		return ProviderResponse{Content: "<score>0.9</score>"}, nil
+	}}
+
+	chunks := map[string]parser.ParsedChunk{
+		"ok.go:1-1":     {FilePath: "ok.go", StartLine: 1, EndLine: 1, Content: "package ok"},
+		"broken.go:1-1": {FilePath: "broken.go", StartLine: 1, EndLine: 1, Content: "package broken"},
+	}
+
+	tests := []struct {
+		name   string
+		policy FailurePolicy
+		ranked int
+		failed int
+		err    bool
+	}{
+		{"report", FailurePolicyReport, 1, 1, false},
+		{"fail", FailurePolicyFail, 0, 0, true},
+		{"default fails", "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(t, map[string]ScoringProvider{"fake": provider}, Options{FailurePolicy: tt.policy})
+
+			parsedChan := make(chan parser.ParsedChunk, len(chunks))
+			rankedChan := make(chan RankedChunk, len(chunks))
+			failedChan := make(chan FailedChunk, len(chunks))
+			err := engine.RankChunksStream(context.Background(), "query", ChunkChannel(chunks), 0, parsedChan, rankedChan, failedChan)
+			close(rankedChan)
+			close(failedChan)
+
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if tt.err {
+				return
+			}
+			if len(rankedChan) != tt.ranked {
+				t.Errorf("expected %d ranked chunks, got %d", tt.ranked, len(rankedChan))
+			}
+			if len(failedChan) != tt.failed {
+				t.Fatalf("expected %d failed chunks, got %d", tt.failed, len(failedChan))
+			}
+			for failed := range failedChan {
+				if failed.ParsedChunk.FilePath != "broken.go" || !strings.Contains(failed.Reason, "bad chunk") {
+					t.Errorf("expected broken.go to fail with the provider's error, got %+v", failed)
+				}
+			}
+		})
+	}
+}
+
+func TestNewEngineRejectsUnknownSettings(t *testing.T) {
+	providers := map[string]ScoringProvider{"fake": scoreProvider("model", "0.5")}
+
+	if _, err := NewEngine(providers, "other", 1, Options{}); err == nil {
+		t.Error("expected an unknown provider to be rejected")
+	}
+	if _, err := NewEngine(providers, "fake", 1, Options{FailurePolicy: "ignore"}); err == nil {
+		t.Error("expected an unknown failure policy to be rejected")
+	}
+}
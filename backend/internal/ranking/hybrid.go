@@ -0,0 +1,167 @@
+package ranking
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"rankmyrepo/internal/parser"
+	"sort"
+	"sync"
+)
+
+const (
+	// FusionRRF merges rankings with reciprocal rank fusion, ignoring raw scores.
+	FusionRRF = "rrf"
+	// FusionWeighted blends min-max normalized scores by engine weight.
+	FusionWeighted = "weighted"
+)
+
+// rrfK dampens the influence of top ranks in reciprocal rank fusion; 60 is the value
+// from the original paper.
+const rrfK = 60
+
+// HybridEngine runs several ranking engines on the same chunks and fuses their results.
+// Engines are referred to by name (e.g. "bm25", "embedding", "llm") so weights can be
+// chosen per request; engines with a zero weight are not run at all.
+type HybridEngine struct {
+	engines        map[string]RankingEngine
+	defaultWeights map[string]float64
+}
+
+func NewHybridEngine(engines map[string]RankingEngine, defaultWeights map[string]float64) *HybridEngine {
+	return &HybridEngine{
+		engines:        engines,
+		defaultWeights: defaultWeights,
+	}
+}
+
+// WithEngine returns a copy of the hybrid engine that runs engine under name, e.g. the
+// LLM engine with the scoring provider of a request.
+func (h *HybridEngine) WithEngine(name string, engine RankingEngine) *HybridEngine {
+	engines := make(map[string]RankingEngine, len(h.engines))
+	for n, e := range h.engines {
+		engines[n] = e
+	}
+	engines[name] = engine
+
+	return &HybridEngine{
+		engines:        engines,
+		defaultWeights: h.defaultWeights,
+	}
+}
+
+func (h *HybridEngine) RankChunks(ctx context.Context, query string, chunks map[string]parser.ParsedChunk) ([]RankedChunk, error) {
+	return h.RankChunksWith(ctx, query, chunks, nil, FusionRRF)
+}
+
+// RankChunksWith ranks the chunks with the given engine weights, falling back to the
+// default weights when none are given. The fused scores are scaled so the best chunk
+// scores 1.0.
+func (h *HybridEngine) RankChunksWith(ctx context.Context, query string, chunks map[string]parser.ParsedChunk, weights map[string]float64, fusion string) ([]RankedChunk, error) {
+	if len(weights) == 0 {
+		weights = h.defaultWeights
+	}
+	if fusion == "" {
+		fusion = FusionRRF
+	}
+	if fusion != FusionRRF && fusion != FusionWeighted {
+		return nil, fmt.Errorf("unknown fusion method %q", fusion)
+	}
+
+	var names []string
+	for name, weight := range weights {
+		if weight <= 0 {
+			continue
+		}
+		if _, ok := h.engines[name]; !ok {
+			return nil, fmt.Errorf("unknown ranking engine %q", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no ranking engine has a positive weight")
+	}
+	sort.Strings(names)
+
+	results := make([][]RankedChunk, len(names))
+	errors := make(chan error, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, engine RankingEngine) {
+			defer wg.Done()
+
+			ranked, err := engine.RankChunks(ctx, query, chunks)
+			if err != nil {
+				errors <- fmt.Errorf("%s: %w", names[i], err)
+				return
+			}
+			results[i] = ranked
+		}(i, h.engines[name])
+	}
+	wg.Wait()
+	close(errors)
+
+	if err := <-errors; err != nil {
+		return nil, err
+	}
+
+	fused := make(map[string]*RankedChunk, len(chunks))
+	for i, ranked := range results {
+		weight := weights[names[i]]
+		contributions := contributions(ranked, fusion)
+
+		for j, chunk := range ranked {
+			key := chunk.ParsedChunk.Location()
+			entry, ok := fused[key]
+			if !ok {
+				entry = &RankedChunk{ParsedChunk: chunk.ParsedChunk}
+				fused[key] = entry
+			}
+			entry.Score += weight * contributions[j]
+		}
+	}
+
+	merged := make([]RankedChunk, 0, len(fused))
+	var maxScore float64
+	for _, chunk := range fused {
+		merged = append(merged, *chunk)
+		maxScore = math.Max(maxScore, chunk.Score)
+	}
+	if maxScore > 0 {
+		for i := range merged {
+			merged[i].Score /= maxScore
+		}
+	}
+
+	sortRanked(merged)
+
+	return merged, nil
+}
+
+// contributions returns what every chunk of a single engine's ranking adds to the
+// fused score, before weighting. ranked must be sorted by descending score.
+func contributions(ranked []RankedChunk, fusion string) []float64 {
+	values := make([]float64, len(ranked))
+	if len(ranked) == 0 {
+		return values
+	}
+
+	if fusion == FusionRRF {
+		for i := range ranked {
+			values[i] = 1 / float64(rrfK+i+1)
+		}
+		return values
+	}
+
+	high, low := ranked[0].Score, ranked[len(ranked)-1].Score
+	for i, chunk := range ranked {
+		if high > low {
+			values[i] = (chunk.Score - low) / (high - low)
+		} else {
+			values[i] = 1
+		}
+	}
+	return values
+}
@@ -0,0 +1,136 @@
+package ranking
+
+import (
+	"context"
+	"math"
+	"rankmyrepo/internal/parser"
+	"strings"
+	"testing"
+)
+
+// fixedEngine ranks chunks with fixed scores by file path.
+type fixedEngine map[string]float64
+
+func (e fixedEngine) RankChunks(ctx context.Context, query string, chunks map[string]parser.ParsedChunk) ([]RankedChunk, error) {
+	var ranked []RankedChunk
+	for _, chunk := range chunks {
+		ranked = append(ranked, RankedChunk{ParsedChunk: chunk, Score: e[chunk.FilePath]})
+	}
+	sortRanked(ranked)
+	return ranked, nil
+}
+
+func TestContributions(t *testing.T) {
+	tests := []struct {
+		name   string
+		fusion string
+		scores []float64
+		want   []float64
+	}{
+		{"rrf ignores scores", FusionRRF, []float64{0.9, 0.1}, []float64{1.0 / 61, 1.0 / 62}},
+		{"weighted normalizes", FusionWeighted, []float64{0.8, 0.6, 0.4}, []float64{1, 0.5, 0}},
+		{"weighted equal scores", FusionWeighted, []float64{0.3, 0.3}, []float64{1, 1}},
+		{"empty", FusionRRF, nil, []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked := make([]RankedChunk, len(tt.scores))
+			for i, score := range tt.scores {
+				ranked[i].Score = score
+			}
+
+			got := contributions(ranked, tt.fusion)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHybridEngineFusesRankings(t *testing.T) {
+	chunks := map[string]parser.ParsedChunk{
+		"a:1-1": {FilePath: "a", StartLine: 1, EndLine: 1},
+		"b:1-1": {FilePath: "b", StartLine: 1, EndLine: 1},
+		"c:1-1": {FilePath: "c", StartLine: 1, EndLine: 1},
+	}
+	hybrid := NewHybridEngine(map[string]RankingEngine{
+		"lexical":  fixedEngine{"a": 0.9, "b": 0.5, "c": 0.1},
+		"semantic": fixedEngine{"a": 0.2, "b": 1.0, "c": 0.6},
+	}, map[string]float64{"lexical": 1})
+
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		fusion  string
+		want    string
+		err     string
+	}{
+		{"default weights", nil, "", "a,b,c", ""},
+		{"one engine", map[string]float64{"semantic": 1}, FusionRRF, "b,c,a", ""},
+		// b is ranked high by both engines, a only by one.
+		{"rrf", map[string]float64{"lexical": 1, "semantic": 1}, FusionRRF, "b,a,c", ""},
+		{"weighted", map[string]float64{"lexical": 3, "semantic": 1}, FusionWeighted, "a,b,c", ""},
+		{"zero weight is not run", map[string]float64{"lexical": 0, "semantic": 1}, FusionWeighted, "b,c,a", ""},
+		{"unknown engine", map[string]float64{"llm": 1}, FusionRRF, "", `unknown ranking engine "llm"`},
+		{"no positive weight", map[string]float64{"lexical": 0}, FusionRRF, "", "no ranking engine has a positive weight"},
+		{"unknown fusion", nil, "max", "", `unknown fusion method "max"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked, err := hybrid.RankChunksWith(context.Background(), "query", chunks, tt.weights, tt.fusion)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to rank chunks: %v", err)
+			}
+
+			var order []string
+			for _, chunk := range ranked {
+				order = append(order, chunk.ParsedChunk.FilePath)
+			}
+			if got := strings.Join(order, ","); got != tt.want {
+				t.Errorf("expected order %s, got %s", tt.want, got)
+			}
+			if ranked[0].Score != 1 {
+				t.Errorf("expected the best chunk to score 1, got %v", ranked[0].Score)
+			}
+		})
+	}
+}
+
+func TestHybridEngineWithEngine(t *testing.T) {
+	chunks := map[string]parser.ParsedChunk{
+		"a:1-1": {FilePath: "a", StartLine: 1, EndLine: 1},
+		"b:1-1": {FilePath: "b", StartLine: 1, EndLine: 1},
+	}
+	hybrid := NewHybridEngine(map[string]RankingEngine{RankerLLM: fixedEngine{"a": 1, "b": 0}}, map[string]float64{RankerLLM: 1})
+	replaced := hybrid.WithEngine(RankerLLM, fixedEngine{"a": 0, "b": 1})
+
+	for _, tt := range []struct {
+		name   string
+		hybrid *HybridEngine
+		want   string
+	}{
+		{"original", hybrid, "a"},
+		{"replaced", replaced, "b"},
+	} {
+		ranked, err := tt.hybrid.RankChunks(context.Background(), "query", chunks)
+		if err != nil {
+			t.Fatalf("failed to rank chunks: %v", err)
+		}
+		if got := ranked[0].ParsedChunk.FilePath; got != tt.want {
+			t.Errorf("%s: expected %s first, got %s", tt.name, tt.want, got)
+		}
+	}
+}
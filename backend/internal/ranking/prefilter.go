@@ -0,0 +1,48 @@
+package ranking
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rankmyrepo/internal/parser"
+)
+
+// Prefilter narrows the chunks of a repository down to the topK best matches of a
+// cheap ranking engine, so the expensive LLM ranking only sees plausible candidates.
+type Prefilter struct {
+	engine RankingEngine
+	topK   int
+}
+
+func NewPrefilter(engine RankingEngine, topK int) *Prefilter {
+	return &Prefilter{
+		engine: engine,
+		topK:   topK,
+	}
+}
+
+func (f *Prefilter) Filter(ctx context.Context, query string, chunks map[string]parser.ParsedChunk) (map[string]parser.ParsedChunk, error) {
+	if len(chunks) <= f.topK {
+		return chunks, nil
+	}
+
+	ranked, err := f.engine.RankChunks(ctx, query, chunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prefilter chunks: %w", err)
+	}
+
+	filtered := make(map[string]parser.ParsedChunk, f.topK)
+	for _, chunk := range ranked[:min(f.topK, len(ranked))] {
+		filtered[chunk.ParsedChunk.Location()] = chunk.ParsedChunk
+	}
+	// Hunks of a review are kept regardless of their rank.
+	for location, chunk := range chunks {
+		if chunk.Hunk {
+			filtered[location] = chunk
+		}
+	}
+
+	log.Printf("Prefilter kept %d of %d chunks", len(filtered), len(chunks))
+
+	return filtered, nil
+}
@@ -12,6 +12,11 @@ import (
 var systemPrompt = `You are a code ranking assistant. Your task is to analyze code chunks and assign them relevance scores based on how well they help answer the user's query. Be direct and precise in your scoring. Only output a score tag with a number between 0.0 and 1.0. Higher scores mean the code is more relevant for answering the query.`
 
 func buildRankingPrompt(query string, chunk parser.ParsedChunk) string {
+	var lastCommit string
+	if chunk.LastCommit != nil {
+		lastCommit = "Last changed in: " + chunk.LastCommit.String() + "\n"
+	}
+
 	return `Rate how relevant this code is to answering the query.
 Score from 0.0 to 1.0 with max 1 decimal point.
 Return ONLY <score>X</score> where X is the score.
@@ -20,8 +25,8 @@ Return ONLY <score>X</score> where X is the score.
 
 Query: ` + query + `
 
-File: ` + chunk.FilePath + `
-Code:
+File: ` + chunk.Location() + `
+` + lastCommit + `Code:
 ` + chunk.Content + `
 
 Remember: Just return <score>X</score> with X between 0.0-1.0, one decimal max.`
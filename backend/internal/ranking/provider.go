@@ -0,0 +1,224 @@
+package ranking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/replicate/replicate-go"
+)
+
+// ScoringProvider sends a ranking prompt to a language model and returns the model's
+// reply, which is expected to contain a <score> tag. Refused and truncated replies are
+// reported as *RefusalError and *TruncationError.
+type ScoringProvider interface {
+	// ModelID identifies the provider and model, e.g. "fireworks/llama-v3p2-3b-instruct".
+	// Scores are cached per model ID.
+	ModelID() string
+	Complete(ctx context.Context, systemPrompt, prompt string) (ProviderResponse, error)
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ReplicateProvider runs models hosted on Replicate.
+type ReplicateProvider struct {
+	r8    *replicate.Client
+	model string
+}
+
+func NewReplicateProvider(r8 *replicate.Client, model string) *ReplicateProvider {
+	return &ReplicateProvider{
+		r8:    r8,
+		model: model,
+	}
+}
+
+func (p *ReplicateProvider) ModelID() string {
+	return "replicate/" + p.model
+}
+
+func (p *ReplicateProvider) Complete(ctx context.Context, systemPrompt, prompt string) (ProviderResponse, error) {
+	input := replicate.PredictionInput{
+		"prompt":        prompt,
+		"system_prompt": systemPrompt,
+		"temperature":   0.1,
+	}
+
+	output, err := p.r8.Run(ctx, p.model, input, nil)
+	if err != nil {
+		return ProviderResponse{}, fmt.Errorf("failed to run model: %w", err)
+	}
+
+	tokens, ok := output.([]interface{})
+	if !ok {
+		return ProviderResponse{}, fmt.Errorf("unexpected output type from model: got %T, want []interface{}", output)
+	}
+
+	var result string
+	for _, token := range tokens {
+		if str, ok := token.(string); ok {
+			result += str
+		}
+	}
+
+	return ProviderResponse{Content: result}, nil
+}
+
+// OpenAICompatibleProvider talks to any endpoint implementing the OpenAI chat
+// completions API, such as Fireworks, OpenAI, Together or vLLM.
+type OpenAICompatibleProvider struct {
+	name    string
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+func NewOpenAICompatibleProvider(name, baseURL, apiKey, model string) *OpenAICompatibleProvider {
+	return &OpenAICompatibleProvider{
+		name:    name,
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{},
+	}
+}
+
+func NewFireworksProvider(apiKey, model string) *OpenAICompatibleProvider {
+	return NewOpenAICompatibleProvider("fireworks", "https://api.fireworks.ai/inference/v1", apiKey, model)
+}
+
+func (p *OpenAICompatibleProvider) ModelID() string {
+	return p.name + "/" + p.model
+}
+
+func (p *OpenAICompatibleProvider) Complete(ctx context.Context, systemPrompt, prompt string) (ProviderResponse, error) {
+	requestBody := struct {
+		Model       string        `json:"model"`
+		Temperature float64       `json:"temperature"`
+		Messages    []chatMessage `json:"messages"`
+	}{
+		Model:       p.model,
+		Temperature: 0.1,
+		Messages: []chatMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: prompt},
+		},
+	}
+
+	body, err := postJSON(ctx, p.client, p.baseURL+"/chat/completions", p.apiKey, requestBody)
+	if err != nil {
+		return ProviderResponse{}, err
+	}
+
+	return decodeChatCompletion(body)
+}
+
+// OllamaProvider talks to a local Ollama-style server through its /api/chat endpoint.
+type OllamaProvider struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func NewOllamaProvider(baseURL, model string) *OllamaProvider {
+	return &OllamaProvider{
+		baseURL: baseURL,
+		model:   model,
+		client:  &http.Client{},
+	}
+}
+
+func (p *OllamaProvider) ModelID() string {
+	return "ollama/" + p.model
+}
+
+func (p *OllamaProvider) Complete(ctx context.Context, systemPrompt, prompt string) (ProviderResponse, error) {
+	requestBody := struct {
+		Model    string        `json:"model"`
+		Stream   bool          `json:"stream"`
+		Messages []chatMessage `json:"messages"`
+		Options  struct {
+			Temperature float64 `json:"temperature"`
+		} `json:"options"`
+	}{
+		Model: p.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: prompt},
+		},
+	}
+	requestBody.Options.Temperature = 0.1
+
+	body, err := postJSON(ctx, p.client, p.baseURL+"/api/chat", "", requestBody)
+	if err != nil {
+		return ProviderResponse{}, err
+	}
+
+	var response struct {
+		Message         chatMessage `json:"message"`
+		DoneReason      string      `json:"done_reason"`
+		PromptEvalCount int         `json:"prompt_eval_count"`
+		EvalCount       int         `json:"eval_count"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return ProviderResponse{}, fmt.Errorf("decoding response: %w", err)
+	}
+
+	result := ProviderResponse{
+		Content: response.Message.Content,
+		Usage: Usage{
+			PromptTokens:     response.PromptEvalCount,
+			CompletionTokens: response.EvalCount,
+			TotalTokens:      response.PromptEvalCount + response.EvalCount,
+		},
+	}
+
+	return result, checkFinishReason(response.DoneReason, response.Message.Content)
+}
+
+// postJSON posts v as JSON and returns the response body of a successful request.
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, v any) ([]byte, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	if apiKey != "" {
+		req.Header.Add("Authorization", "Bearer "+apiKey)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,67 @@
+package ranking
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiterRejectsInvalidRates(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		ok    bool
+	}{
+		{"valid", 5, 5, true},
+		{"fractional", 0.5, 1, true},
+		{"zero", 0, 1, false},
+		{"negative", -1, 1, false},
+		{"not a number", math.NaN(), 1, false},
+		{"infinite", math.Inf(1), 1, false},
+		{"zero burst", 5, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := NewRateLimiter(tt.rate, tt.burst)
+			if ok := err == nil; ok != tt.ok {
+				t.Fatalf("expected valid %v, got %v", tt.ok, err)
+			}
+			if ok := limiter != nil; ok != tt.ok {
+				t.Errorf("expected a limiter %v, got %v", tt.ok, limiter)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter, err := NewRateLimiter(50, 2)
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+
+	// The burst is available at once, the next token after 1/50s.
+	start := time.Now()
+	for range 3 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("failed to wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected to wait about 20ms for the third call, waited %v", elapsed)
+	}
+
+	slow, err := NewRateLimiter(0.001, 1)
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+	slow.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := slow.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package ranking
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Usage is the number of tokens a single ranking call consumed.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// ProviderResponse is the reply of a scoring provider.
+type ProviderResponse struct {
+	Content string
+	Usage   Usage
+}
+
+// RefusalError is returned when the model declined to answer, either explicitly or
+// because its output was filtered.
+type RefusalError struct {
+	Message string
+}
+
+func (e *RefusalError) Error() string {
+	return fmt.Sprintf("model refused to answer: %s", e.Message)
+}
+
+// TruncationError is returned when the model stopped before finishing its answer. The
+// partial content is kept, since it may still contain a complete score.
+type TruncationError struct {
+	FinishReason string
+	Content      string
+}
+
+func (e *TruncationError) Error() string {
+	return fmt.Sprintf("model output was truncated (finish reason %q)", e.FinishReason)
+}
+
+type chatCompletionResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index   int `json:"index"`
+		Message struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+}
+
+// decodeChatCompletion extracts the message content and token usage from an OpenAI
+// chat completions response body.
+func decodeChatCompletion(body []byte) (ProviderResponse, error) {
+	var response chatCompletionResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return ProviderResponse{}, fmt.Errorf("decoding response: %w", err)
+	}
+
+	if len(response.Choices) == 0 {
+		return ProviderResponse{Usage: response.Usage}, fmt.Errorf("response contains no choices")
+	}
+
+	choice := response.Choices[0]
+	result := ProviderResponse{
+		Content: choice.Message.Content,
+		Usage:   response.Usage,
+	}
+
+	if choice.Message.Refusal != "" {
+		return result, &RefusalError{Message: choice.Message.Refusal}
+	}
+
+	return result, checkFinishReason(choice.FinishReason, choice.Message.Content)
+}
+
+func checkFinishReason(reason, content string) error {
+	switch reason {
+	case "length":
+		return &TruncationError{FinishReason: reason, Content: content}
+	case "content_filter":
+		return &RefusalError{Message: "output was blocked by the content filter"}
+	}
+	return nil
+}
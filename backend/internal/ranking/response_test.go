@@ -0,0 +1,167 @@
+package ranking
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"rankmyrepo/internal/parser"
+	"testing"
+)
+
+func TestDecodeChatCompletion(t *testing.T) {
+	usage := Usage{PromptTokens: 100, CompletionTokens: 5, TotalTokens: 105}
+
+	tests := []struct {
+		name      string
+		body      string
+		content   string
+		usage     Usage
+		refusal   bool
+		truncated bool
+		err       bool
+	}{
+		{
+			name:    "answer",
+			body:    `{"choices":[{"message":{"content":"<score>0.7</score>"},"finish_reason":"stop"}],"usage":{"prompt_tokens":100,"completion_tokens":5,"total_tokens":105}}`,
+			content: "<score>0.7</score>",
+			usage:   usage,
+		},
+		{
+			name:    "refusal",
+			body:    `{"choices":[{"message":{"refusal":"I cannot help with that"},"finish_reason":"stop"}],"usage":{"prompt_tokens":100,"completion_tokens":5,"total_tokens":105}}`,
+			usage:   usage,
+			refusal: true,
+		},
+		{
+			name:    "content filter",
+			body:    `{"choices":[{"message":{"content":""},"finish_reason":"content_filter"}]}`,
+			refusal: true,
+		},
+		{
+			name:      "truncated",
+			body:      `{"choices":[{"message":{"content":"<score>0.4</score> because"},"finish_reason":"length"}],"usage":{"prompt_tokens":100,"completion_tokens":5,"total_tokens":105}}`,
+			content:   "<score>0.4</score> because",
+			usage:     usage,
+			truncated: true,
+		},
+		{
+			name:  "no choices",
+			body:  `{"choices":[],"usage":{"prompt_tokens":100,"completion_tokens":5,"total_tokens":105}}`,
+			usage: usage,
+			err:   true,
+		},
+		{
+			name: "invalid JSON",
+			body: `{"choices":`,
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := decodeChatCompletion([]byte(tt.body))
+
+			var refusal *RefusalError
+			var truncated *TruncationError
+			switch {
+			case tt.refusal:
+				if !errors.As(err, &refusal) {
+					t.Errorf("expected a refusal, got %v", err)
+				}
+			case tt.truncated:
+				if !errors.As(err, &truncated) || truncated.Content != tt.content {
+					t.Errorf("expected a truncation keeping the content, got %v", err)
+				}
+			case tt.err:
+				if err == nil {
+					t.Error("expected an error")
+				}
+			case err != nil:
+				t.Errorf("failed to decode response: %v", err)
+			}
+
+			if response.Content != tt.content {
+				t.Errorf("expected content %q, got %q", tt.content, response.Content)
+			}
+			if response.Usage != tt.usage {
+				t.Errorf("expected usage %+v, got %+v", tt.usage, response.Usage)
+			}
+		})
+	}
+}
+
+func TestProvidersDecodeUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat/completions":
+			w.Write([]byte(`{"choices":[{"message":{"content":"<score>0.6</score>"},"finish_reason":"stop"}],"usage":{"prompt_tokens":40,"completion_tokens":4,"total_tokens":44}}`))
+		case "/api/chat":
+			w.Write([]byte(`{"message":{"role":"assistant","content":"<score>0.6</score>"},"done_reason":"stop","prompt_eval_count":40,"eval_count":4}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		provider ScoringProvider
+	}{
+		{"openai", NewOpenAICompatibleProvider("openai", server.URL, "key", "model")},
+		{"ollama", NewOllamaProvider(server.URL, "model")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := tt.provider.Complete(context.Background(), systemPrompt, "prompt")
+			if err != nil {
+				t.Fatalf("failed to complete: %v", err)
+			}
+			want := Usage{PromptTokens: 40, CompletionTokens: 4, TotalTokens: 44}
+			if response.Content != "<score>0.6</score>" || response.Usage != want {
+				t.Errorf("expected the score with usage %+v, got %+v", want, response)
+			}
+		})
+	}
+}
+
+func TestEngineRecordsUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		response ProviderResponse
+		err      error
+		score    float64
+		failed   bool
+	}{
+		{"answer", ProviderResponse{Content: "<score>0.5</score>"}, nil, 0.5, false},
+		{"truncated after the score", ProviderResponse{Content: "<score>0.5</score> bec"}, &TruncationError{FinishReason: "length", Content: "<score>0.5</score> bec"}, 0.5, false},
+		{"truncated before the score", ProviderResponse{Content: "<sco"}, &TruncationError{FinishReason: "length", Content: "<sco"}, 0, true},
+		{"refusal", ProviderResponse{}, &RefusalError{Message: "no"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.response.Usage = Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}
+			provider := &fakeProvider{complete: func(string) (ProviderResponse, error) {
+				return tt.response, tt.err
+			}}
+			engine := newTestEngine(t, map[string]ScoringProvider{"fake": provider}, Options{})
+
+			chunk := parser.ParsedChunk{FilePath: "a.go", StartLine: 1, EndLine: 1}
+			score, usage, err := engine.RankSingleChunk(context.Background(), "query", chunk)
+			if failed := err != nil; failed != tt.failed {
+				t.Fatalf("expected failure %v, got %v", tt.failed, err)
+			}
+			if score != tt.score {
+				t.Errorf("expected score %v, got %v", tt.score, score)
+			}
+			if usage != tt.response.Usage {
+				t.Errorf("expected usage %+v, got %+v", tt.response.Usage, usage)
+			}
+			if total := engine.Usage(); total != tt.response.Usage {
+				t.Errorf("expected total usage %+v, got %+v", tt.response.Usage, total)
+			}
+		})
+	}
+}
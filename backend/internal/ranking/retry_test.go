@@ -0,0 +1,164 @@
+package ranking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", &StatusError{StatusCode: http.StatusBadGateway}, true},
+		{"wrapped server error", fmt.Errorf("scoring: %w", &StatusError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"bad request", &StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &StatusError{StatusCode: http.StatusUnauthorized}, false},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"cancelled", context.Canceled, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"refusal", &RefusalError{Message: "no"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{"0", 0, 0},
+		{"-1", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{80, time.Second},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			if delay := policy.backoff(tt.attempt); delay < 0 || delay > tt.ceiling {
+				t.Errorf("backoff(%d) = %v, want at most %v", tt.attempt, delay, tt.ceiling)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	transient := &StatusError{StatusCode: http.StatusServiceUnavailable}
+	permanent := &StatusError{StatusCode: http.StatusBadRequest}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"recovers", []error{transient, transient, nil}, 3, nil},
+		{"gives up", []error{transient, transient, transient, transient}, 3, transient},
+		{"permanent failure", []error{permanent, nil}, 1, permanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := testRetryPolicy.Do(context.Background(), func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+			if err != tt.err {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("expected %d attempts, got %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyHonoursRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: 50 * time.Millisecond}
+
+	// Retry-After wins over the backoff but is capped at MaxDelay.
+	start := time.Now()
+	attempts := 0
+	err := policy.Do(context.Background(), func() error {
+		attempts++
+		if attempts == 1 {
+			return &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("expected success on the second attempt, got %v after %d attempts", err, attempts)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected to wait MaxDelay, waited %v", elapsed)
+	}
+
+	// A cancelled context stops waiting and returns the last error.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	policy.MaxDelay = time.Hour
+	limited := &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+	if err := policy.Do(ctx, func() error { return limited }); err != limited {
+		t.Errorf("expected the last error, got %v", err)
+	}
+}
+
+func TestPostJSONReportsRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := postJSON(context.Background(), server.Client(), server.URL, "", struct{}{})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusTooManyRequests || statusErr.RetryAfter != 7*time.Second {
+		t.Errorf("expected status 429 with a 7s Retry-After, got %d and %v", statusErr.StatusCode, statusErr.RetryAfter)
+	}
+}
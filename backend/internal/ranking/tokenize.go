@@ -0,0 +1,62 @@
+package ranking
+
+import (
+	"strings"
+	"unicode"
+)
+
+// tokenize splits text into lower-cased terms the way code search expects: identifiers
+// are split on camelCase, PascalCase, snake_case and kebab-case boundaries, and the
+// joined identifier is kept as a term of its own so exact matches still score highest.
+func tokenize(text string) []string {
+	var tokens []string
+
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		parts := splitIdentifier(word)
+		if len(parts) > 1 {
+			tokens = append(tokens, strings.ToLower(strings.ReplaceAll(word, "_", "")))
+		}
+		for _, part := range parts {
+			tokens = append(tokens, strings.ToLower(part))
+		}
+	}
+
+	return tokens
+}
+
+// splitIdentifier splits an identifier such as "ProcessRankingRequestStream",
+// "parse_http_URL" or "HTTPServer" into its words.
+func splitIdentifier(word string) []string {
+	var (
+		parts []string
+		runes = []rune(word)
+		start = 0
+	)
+
+	flush := func(end int) {
+		if end > start {
+			parts = append(parts, string(runes[start:end]))
+		}
+		start = end
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '_':
+			flush(i)
+			start = i + 1
+		case i > start && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]):
+			flush(i)
+		case i > start && unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]):
+			flush(i)
+		case i > start && unicode.IsDigit(r) != unicode.IsDigit(runes[i-1]):
+			flush(i)
+		}
+	}
+	flush(len(runes))
+
+	return parts
+}
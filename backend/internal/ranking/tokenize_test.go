@@ -0,0 +1,31 @@
+package ranking
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"retry the request", "retry the request"},
+		{"ProcessRankingRequestStream", "processrankingrequeststream process ranking request stream"},
+		{"parse_http_URL", "parsehttpurl parse http url"},
+		{"HTTPServer", "httpserver http server"},
+		{"base64Decode", "base64decode base 64 decode"},
+		{"max-retries", "max retries"},
+		{"ctx.Err() != nil", "ctx err nil"},
+		{"größe Überlauf", "größe überlauf"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := strings.Join(tokenize(tt.text), " "); got != tt.want {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
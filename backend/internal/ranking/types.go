@@ -8,17 +8,76 @@ import (
 type RankedChunk struct {
 	ParsedChunk parser.ParsedChunk
 	Score       float64
+	// Usage holds the tokens spent scoring the chunk. It is zero for engines that do
+	// not call a model and for scores served from the cache.
+	Usage Usage
+}
+
+// FailedChunk is a chunk that could not be scored, together with the reason.
+type FailedChunk struct {
+	ParsedChunk parser.ParsedChunk
+	Reason      string
 }
 
 type RankingEngine interface {
 	RankChunks(ctx context.Context, query string, chunks map[string]parser.ParsedChunk) ([]RankedChunk, error)
 }
 
+const (
+	RankerLLM       = "llm"
+	RankerBM25      = "bm25"
+	RankerEmbedding = "embedding"
+	RankerHybrid    = "hybrid"
+)
+
 type RankingRequest struct {
-	Query          string
-	RepoPath       string
+	Query    string
+	RepoPath string
+	// Ref is the branch, tag or commit SHA to answer from. It defaults to the default
+	// branch of the repository.
+	Ref            string
 	IgnorePatterns []string
-	ScoreThreshold float64
+	// IncludePatterns, Languages and PathPrefix narrow the parsed files down to
+	// matching globs, languages and a directory. See parser.ParseOptions.
+	IncludePatterns []string
+	Languages       []string
+	PathPrefix      string
+	// NoDefaultIgnores also parses dependencies, build output and lockfiles.
+	NoDefaultIgnores bool
+	ScoreThreshold   float64
+	// Ranker selects the ranking engine. It defaults to RankerLLM; RankerBM25 ranks
+	// lexically without any model calls and RankerHybrid fuses several engines.
+	Ranker string
+	// EngineWeights sets the weight of each engine for RankerHybrid, keyed by ranker
+	// name. Engines left out are not run.
+	EngineWeights map[string]float64
+	// Fusion is FusionRRF (default) or FusionWeighted.
+	Fusion string
+	// CloneMode is "full", "shallow" or "sparse". By default large GitHub
+	// repositories are cloned shallowly and everything else in full.
+	CloneMode string
+	// SparsePaths limits the checkout to these directories of the repository. Sparse
+	// clones default to the directories of PathPrefix or IncludePatterns.
+	SparsePaths []string
+	// InMemory reads the repository from an in-memory clone instead of a checkout.
+	InMemory bool
+	// History adds blame information and recent commits to the parsed chunks. See
+	// parser.HistoryOptions.
+	History parser.HistoryOptions
+	// SubmoduleDepth also parses submodules, recursing this many levels deep.
+	SubmoduleDepth int
+	// BaseRef asks about the change from BaseRef to Ref instead of the code at Ref.
+	// The hunks of the change are always part of the answer, which reviews the change.
+	BaseRef string
+	// Credentials authenticate the clone of a private repository.
+	Credentials *parser.Credentials
+	// Archive is the path of an uploaded archive to parse instead of RepoPath, and
+	// ArchiveName its original file name. Both are set by the server only.
+	Archive     string `json:"-"`
+	ArchiveName string `json:"-"`
+	// Provider selects the scoring provider of the LLM ranker by name. It defaults to
+	// the provider configured for the deployment.
+	Provider string
 }
 
 type RankingResponse struct {
@@ -0,0 +1,352 @@
+package repocache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+const (
+	repoDirName   = "repo"
+	chunksDirName = "chunks"
+	lastUsedName  = "last-used"
+	privateName   = "private"
+)
+
+// ErrAuthRequired is returned when a repository that was cloned with credentials is
+// requested without any. Cached contents of private repositories are only served to
+// requests that successfully authenticate against the remote.
+var ErrAuthRequired = errors.New("authentication required")
+
+// ErrUnknownRef is returned when a requested branch, tag or commit does not exist in
+// the repository.
+var ErrUnknownRef = errors.New("unknown ref")
+
+// Cache keeps repository clones on disk between requests. Every repository lives in
+// its own entry directory under root, holding the clone itself and any parse results
+// stored for its commits. Entries are evicted least recently used first once the
+// cache grows beyond maxBytes.
+type Cache struct {
+	root     string
+	maxBytes int64
+
+	mu sync.Mutex
+	// locks hold a token while their entry is synced; inUse counts the checkouts of an
+	// entry that have not been released, which keeps it from being evicted.
+	locks map[string]chan struct{}
+	inUse map[string]int
+}
+
+// Checkout is a cached clone holding the objects of Commit. Its working tree at Dir
+// may be moved to other commits by later checkouts of the same entry, so the files of
+// Commit must be read from the commit's tree. The clone must not be used after Release
+// has been called.
+type Checkout struct {
+	Dir    string
+	Commit string
+
+	cache *Cache
+	key   string
+	once  sync.Once
+}
+
+func NewCache(root string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &Cache{
+		root:     root,
+		maxBytes: maxBytes,
+		locks:    make(map[string]chan struct{}),
+		inUse:    make(map[string]int),
+	}, nil
+}
+
+// Checkout returns an up to date working tree of the repository at ref, which is a
+// branch, tag or commit SHA. An empty ref checks out the default branch. The first
+// call clones the repository as described by opts, later calls only fetch what changed
+// since. A shallow entry is deepened to the full history when a full clone is asked
+// for, while full entries also serve shallow requests. auth may be nil for
+// public repositories. The entry is only locked while it is synced, so requests for
+// the same repository wait for each other's fetches but not for each other's parses;
+// a request waits until the entry is unlocked or ctx is done. The entry is not
+// evicted until the returned Checkout is released.
+func (c *Cache) Checkout(ctx context.Context, repoURL, ref string, auth transport.AuthMethod, opts CloneOptions) (*Checkout, error) {
+	key := entryKey(repoURL)
+	if err := c.acquire(ctx, key); err != nil {
+		return nil, err
+	}
+
+	checkout := &Checkout{
+		Dir:   filepath.Join(c.root, key, repoDirName),
+		cache: c,
+		key:   key,
+	}
+
+	// Syncing only adds objects to the clone, so the commit stays readable after the
+	// entry is unlocked.
+	commit, err := c.sync(ctx, repoURL, ref, filepath.Join(c.root, key), auth, opts)
+	c.unlock(key)
+	if err != nil {
+		checkout.Release()
+		return nil, err
+	}
+	checkout.Commit = commit
+
+	c.touch(key)
+
+	return checkout, nil
+}
+
+// Release lets the entry be evicted again and evicts old entries if the cache has grown
+// too large.
+func (co *Checkout) Release() {
+	co.once.Do(func() {
+		co.cache.release(co.key)
+		co.cache.Evict()
+	})
+}
+
+// LoadResult decodes the result stored under name for the checked out commit into v.
+// It reports whether a stored result was found.
+func (co *Checkout) LoadResult(name string, v any) bool {
+	data, err := os.ReadFile(co.resultPath(name))
+	if err != nil {
+		return false
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Printf("discarding corrupt cached result %s: %v", name, err)
+		return false
+	}
+	return true
+}
+
+// StoreResult stores v under name for the checked out commit.
+func (co *Checkout) StoreResult(name string, v any) error {
+	path := co.resultPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create result directory: %w", err)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (co *Checkout) resultPath(name string) string {
+	return filepath.Join(co.cache.root, co.key, chunksDirName, co.Commit, hashString(name)+".json")
+}
+
+func (c *Cache) sync(ctx context.Context, repoURL, ref, entryDir string, auth transport.AuthMethod, opts CloneOptions) (string, error) {
+	dir := filepath.Join(entryDir, repoDirName)
+	privateMarker := filepath.Join(entryDir, privateName)
+
+	repo, err := git.PlainOpen(dir)
+	if err == nil {
+		if _, err := os.Stat(privateMarker); err == nil && auth == nil {
+			return "", ErrAuthRequired
+		}
+		return Update(ctx, repo, ref, auth, opts)
+	}
+	if !errors.Is(err, git.ErrRepositoryNotExists) {
+		log.Printf("cached clone of %s is unusable, cloning again: %v", repoURL, err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("failed to remove stale clone: %w", err)
+	}
+
+	if auth != nil {
+		if err := os.MkdirAll(entryDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create cache entry: %w", err)
+		}
+		if err := os.WriteFile(privateMarker, nil, 0644); err != nil {
+			return "", fmt.Errorf("failed to mark cache entry as private: %w", err)
+		}
+	}
+
+	commit, err := Clone(ctx, dir, repoURL, ref, auth, opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return commit, nil
+}
+
+// Evict removes least recently used entries until the cache fits into maxBytes.
+// Entries that are currently checked out are never evicted.
+func (c *Cache) Evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	dirEntries, err := os.ReadDir(c.root)
+	if err != nil {
+		log.Printf("failed to list repository cache: %v", err)
+		return
+	}
+
+	type entry struct {
+		key      string
+		size     int64
+		lastUsed time.Time
+	}
+
+	var (
+		entries []entry
+		total   int64
+	)
+	for _, d := range dirEntries {
+		if !d.IsDir() {
+			continue
+		}
+		e := entry{
+			key:      d.Name(),
+			size:     dirSize(filepath.Join(c.root, d.Name())),
+			lastUsed: c.lastUsed(d.Name()),
+		}
+		entries = append(entries, e)
+		total += e.size
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	for _, e := range entries {
+		if total <= c.maxBytes {
+			return
+		}
+
+		if !c.tryRemove(e.key) {
+			continue
+		}
+		total -= e.size
+		log.Printf("evicted %s from repository cache (%d bytes)", e.key, e.size)
+	}
+}
+
+func (c *Cache) tryRemove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.inUse[key] > 0 {
+		return false
+	}
+
+	if err := os.RemoveAll(filepath.Join(c.root, key)); err != nil {
+		log.Printf("failed to evict %s from repository cache: %v", key, err)
+		return false
+	}
+	return true
+}
+
+func (c *Cache) acquire(ctx context.Context, key string) error {
+	c.mu.Lock()
+	lock, ok := c.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		c.locks[key] = lock
+	}
+	c.inUse[key]++
+	c.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.leave(key)
+		return ctx.Err()
+	}
+}
+
+// unlock lets the next request sync the entry, which stays in use until it is released.
+func (c *Cache) unlock(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	<-c.locks[key]
+}
+
+func (c *Cache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.leave(key)
+}
+
+// leave drops a user of the entry. c.mu must be held.
+func (c *Cache) leave(key string) {
+	c.inUse[key]--
+	if c.inUse[key] == 0 {
+		delete(c.inUse, key)
+		delete(c.locks, key)
+	}
+}
+
+func (c *Cache) touch(key string) {
+	path := filepath.Join(c.root, key, lastUsedName)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			log.Printf("failed to mark %s as used: %v", key, err)
+		}
+	}
+}
+
+func (c *Cache) lastUsed(key string) time.Time {
+	info, err := os.Stat(filepath.Join(c.root, key, lastUsedName))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func entryKey(repoURL string) string {
+	return hashString(repoURL)
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,139 @@
+package repocache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newTestRepo creates a Git repository with the given number of commits and returns
+// its directory and the hash of its last commit.
+func newTestRepo(t *testing.T, commits int) (string, plumbing.Hash) {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to open worktree: %v", err)
+	}
+
+	var hash plumbing.Hash
+	for i := range commits {
+		if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(fmt.Sprintf("package main // %d\n", i)), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		if _, err := worktree.Add("main.go"); err != nil {
+			t.Fatalf("failed to add test file: %v", err)
+		}
+		hash, err = worktree.Commit(fmt.Sprintf("commit %d", i), &git.CommitOptions{
+			Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+	}
+	return dir, hash
+}
+
+func TestCheckoutSharesEntries(t *testing.T) {
+	repoDir, hash := newTestRepo(t, 1)
+
+	// Every entry is larger than the cache, so only checkouts keep it from eviction.
+	cache, err := NewCache(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	first, err := cache.Checkout(ctx, "file://"+repoDir, "", nil, CloneOptions{})
+	if err != nil {
+		t.Fatalf("failed to check out repository: %v", err)
+	}
+	// The first checkout is still held while the second one is made.
+	second, err := cache.Checkout(ctx, "file://"+repoDir, "", nil, CloneOptions{})
+	if err != nil {
+		t.Fatalf("expected a second checkout while the first is held, got %v", err)
+	}
+	if first.Commit != hash.String() || second.Commit != hash.String() {
+		t.Errorf("expected both checkouts at %s, got %s and %s", hash, first.Commit, second.Commit)
+	}
+
+	first.Release()
+	if _, err := os.Stat(second.Dir); err != nil {
+		t.Errorf("expected the held entry to survive eviction, got %v", err)
+	}
+
+	second.Release()
+	if _, err := os.Stat(second.Dir); !os.IsNotExist(err) {
+		t.Errorf("expected the released entry to be evicted, got %v", err)
+	}
+}
+
+func TestCheckoutDeepensShallowEntries(t *testing.T) {
+	repoDir, hash := newTestRepo(t, 3)
+
+	cache, err := NewCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	// commits checks out the repository in mode and returns its shallow commits and the
+	// number of commits reachable from the checked out one.
+	commits := func(mode CloneMode) ([]plumbing.Hash, int) {
+		t.Helper()
+
+		checkout, err := cache.Checkout(context.Background(), "file://"+repoDir, "", nil, CloneOptions{Mode: mode})
+		if err != nil {
+			t.Fatalf("failed to check out repository in %s mode: %v", mode, err)
+		}
+		defer checkout.Release()
+		if checkout.Commit != hash.String() {
+			t.Errorf("expected commit %s in %s mode, got %s", hash, mode, checkout.Commit)
+		}
+
+		repo, err := git.PlainOpen(checkout.Dir)
+		if err != nil {
+			t.Fatalf("failed to open cached clone: %v", err)
+		}
+		shallow, err := repo.Storer.Shallow()
+		if err != nil {
+			t.Fatalf("failed to read shallow commits: %v", err)
+		}
+		iter, err := repo.Log(&git.LogOptions{From: hash})
+		if err != nil {
+			t.Fatalf("failed to read history: %v", err)
+		}
+		defer iter.Close()
+
+		var count int
+		iter.ForEach(func(*object.Commit) error {
+			count++
+			return nil
+		})
+		return shallow, count
+	}
+
+	if shallow, count := commits(CloneShallow); len(shallow) == 0 || count != 1 {
+		t.Errorf("expected a shallow clone with 1 commit, got shallow commits %v and %d commits", shallow, count)
+	}
+	if shallow, count := commits(CloneFull); len(shallow) != 0 || count != 3 {
+		t.Errorf("expected the full clone to have all 3 commits, got shallow commits %v and %d commits", shallow, count)
+	}
+	// Shallow requests are served from the full clone as it is.
+	if shallow, count := commits(CloneShallow); len(shallow) != 0 || count != 3 {
+		t.Errorf("expected the clone to stay full, got shallow commits %v and %d commits", shallow, count)
+	}
+}
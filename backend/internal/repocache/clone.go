@@ -0,0 +1,481 @@
+package repocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// CloneMode controls how much of a repository is downloaded.
+type CloneMode string
+
+const (
+	// CloneFull clones the complete history of all branches and tags.
+	CloneFull CloneMode = "full"
+	// CloneShallow only fetches the requested commit of a single branch or tag.
+	CloneShallow CloneMode = "shallow"
+	// CloneSparse is a shallow clone that only checks out SparsePaths.
+	CloneSparse CloneMode = "sparse"
+)
+
+type CloneOptions struct {
+	Mode CloneMode
+	// SparsePaths restricts the working tree to these directories, relative to the
+	// repository root. All files are checked out when empty.
+	SparsePaths []string
+}
+
+// Clone clones the repository into dir and checks out ref. It returns the SHA of the
+// checked out commit.
+func Clone(ctx context.Context, dir, repoURL, ref string, auth transport.AuthMethod, opts CloneOptions) (string, error) {
+	if opts.Mode != CloneShallow && opts.Mode != CloneSparse {
+		repo, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+			URL:        repoURL,
+			Auth:       auth,
+			Tags:       git.AllTags,
+			NoCheckout: true,
+			Progress:   os.Stdout,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to clone repository: %w", err)
+		}
+		return checkout(repo, ref, opts.SparsePaths)
+	}
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize repository: %w", err)
+	}
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repoURL},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to add remote: %w", err)
+	}
+
+	return updateShallow(ctx, repo, ref, auth, opts.SparsePaths)
+}
+
+// Update brings an existing clone up to date and checks out ref. Shallow and sparse
+// modes only fetch the requested commit of a shallow clone, other modes fetch all
+// branches and tags, first deepening a shallow clone to the full history.
+func Update(ctx context.Context, repo *git.Repository, ref string, auth transport.AuthMethod, opts CloneOptions) (string, error) {
+	shallow, err := repo.Storer.Shallow()
+	if err != nil {
+		return "", fmt.Errorf("failed to read shallow commits: %w", err)
+	}
+	if len(shallow) > 0 {
+		if opts.Mode == CloneShallow || opts.Mode == CloneSparse {
+			return updateShallow(ctx, repo, ref, auth, opts.SparsePaths)
+		}
+		if err := unshallow(ctx, repo, auth, shallow); err != nil {
+			return "", err
+		}
+		return checkout(repo, ref, opts.SparsePaths)
+	}
+
+	if err := fetch(ctx, repo, auth); err != nil {
+		return "", err
+	}
+	return checkout(repo, ref, opts.SparsePaths)
+}
+
+// unshallow fetches all branches and tags with their full history into a shallow
+// clone, like git fetch --unshallow, and drops the shallow commits whose parents have
+// arrived.
+func unshallow(ctx context.Context, repo *git.Repository, auth transport.AuthMethod, shallow []plumbing.Hash) error {
+	err := repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		// Git asks for this depth to fetch the complete history.
+		Depth: math.MaxInt32,
+		Auth:  auth,
+		Tags:  git.AllTags,
+		Force: true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch the history of the repository: %w", err)
+	}
+
+	// go-git only ever adds shallow commits, so the ones the fetch completed are
+	// removed here.
+	var remaining []plumbing.Hash
+	for _, hash := range shallow {
+		if !hasParents(repo, hash) {
+			remaining = append(remaining, hash)
+		}
+	}
+	if err := repo.Storer.SetShallow(remaining); err != nil {
+		return fmt.Errorf("failed to update shallow commits: %w", err)
+	}
+	return nil
+}
+
+// hasParents reports whether the parents of the commit are in the repository.
+func hasParents(repo *git.Repository, hash plumbing.Hash) bool {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return false
+	}
+	for _, parent := range commit.ParentHashes {
+		if _, err := repo.Storer.EncodedObject(plumbing.CommitObject, parent); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// fetch updates all remote-tracking branches and tags.
+func fetch(ctx context.Context, repo *git.Repository, auth transport.AuthMethod) error {
+	err := repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		Auth:       auth,
+		Tags:       git.AllTags,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch repository: %w", err)
+	}
+	return nil
+}
+
+// CloneMemory clones the repository into memory, without a working tree, and returns
+// it with the commit ref resolves to. Shallow and sparse clones only fetch that commit;
+// its files are read from the commit's tree rather than checked out.
+func CloneMemory(ctx context.Context, repoURL, ref string, auth transport.AuthMethod, opts CloneOptions) (*git.Repository, *object.Commit, error) {
+	var repo *git.Repository
+	if opts.Mode != CloneShallow && opts.Mode != CloneSparse {
+		var err error
+		repo, err = git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{
+			URL:        repoURL,
+			Auth:       auth,
+			Tags:       git.AllTags,
+			NoCheckout: true,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to clone repository: %w", err)
+		}
+	} else {
+		var err error
+		repo, err = git.Init(memory.NewStorage(), nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize repository: %w", err)
+		}
+
+		_, err = repo.CreateRemote(&config.RemoteConfig{
+			Name: git.DefaultRemoteName,
+			URLs: []string{repoURL},
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to add remote: %w", err)
+		}
+
+		if err := fetchShallow(ctx, repo, ref, auth); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	hash, err := Resolve(repo, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+	return repo, commit, nil
+}
+
+// updateShallow fetches ref like fetchShallow and checks it out.
+func updateShallow(ctx context.Context, repo *git.Repository, ref string, auth transport.AuthMethod, sparsePaths []string) (string, error) {
+	if err := fetchShallow(ctx, repo, ref, auth); err != nil {
+		return "", err
+	}
+	return checkout(repo, ref, sparsePaths)
+}
+
+// fetchShallow fetches the tip of the branch or tag named by ref with a depth of one.
+// Servers rarely serve arbitrary commits, so a commit SHA that no branch or tag points
+// at falls back to fetching the full history.
+func fetchShallow(ctx context.Context, repo *git.Repository, ref string, auth transport.AuthMethod) error {
+	name, err := remoteRef(ctx, repo, ref, auth)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		log.Printf("%s is not a branch or tag, fetching the full history", ref)
+		return fetch(ctx, repo, auth)
+	}
+
+	local := name
+	if name.IsBranch() {
+		local = plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name.Short())
+	}
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", name, local))},
+		Depth:      1,
+		Auth:       auth,
+		Tags:       git.NoTags,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch %s: %w", name.Short(), err)
+	}
+
+	if ref == "" {
+		remoteHead := plumbing.NewSymbolicReference(plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName), local)
+		if err := repo.Storer.SetReference(remoteHead); err != nil {
+			return fmt.Errorf("failed to record default branch: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// remoteRef looks ref up among the branches and tags of the remote. An empty ref
+// resolves to the default branch. It returns an empty name for refs that look like
+// commit SHAs.
+func remoteRef(ctx context.Context, repo *git.Repository, ref string, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return "", fmt.Errorf("failed to open remote: %w", err)
+	}
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote refs: %w", err)
+	}
+
+	names := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, r := range refs {
+		names[r.Name()] = r
+	}
+
+	if ref == "" {
+		head, ok := names[plumbing.HEAD]
+		if !ok {
+			return "", fmt.Errorf("failed to resolve default branch: %w", ErrUnknownRef)
+		}
+		if head.Type() == plumbing.SymbolicReference {
+			return head.Target(), nil
+		}
+		for _, r := range refs {
+			if r.Name().IsBranch() && r.Hash() == head.Hash() {
+				return r.Name(), nil
+			}
+		}
+		return "", fmt.Errorf("failed to resolve default branch: %w", ErrUnknownRef)
+	}
+
+	for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(ref), plumbing.NewTagReferenceName(ref)} {
+		if _, ok := names[name]; ok {
+			return name, nil
+		}
+	}
+
+	if IsCommitSHA(ref) {
+		return "", nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownRef, ref)
+}
+
+// IsCommitSHA reports whether ref looks like a full or abbreviated commit SHA.
+func IsCommitSHA(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
+		return false
+	}
+	for _, r := range ref {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkout checks out the commit ref resolves to with a detached HEAD. With sparse
+// paths only the files below them are written. It returns the SHA of the checked out
+// commit.
+func checkout(repo *git.Repository, ref string, sparsePaths []string) (string, error) {
+	hash, err := Resolve(repo, ref)
+	if err != nil {
+		return "", err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to open worktree: %w", err)
+	}
+	root := worktree.Filesystem.Root()
+
+	if len(sparsePaths) > 0 {
+		if err := checkoutSparse(repo, root, hash, sparsePaths); err != nil {
+			return "", fmt.Errorf("failed to check out %s: %w", hash, err)
+		}
+		return hash.String(), nil
+	}
+
+	// An empty index means the working tree is new or was written by checkoutSparse,
+	// so it is cleared rather than trusted to match the index.
+	idx, err := repo.Storer.Index()
+	if err != nil || len(idx.Entries) == 0 {
+		if err := clearWorktree(root); err != nil {
+			return "", err
+		}
+	}
+
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", hash, err)
+	}
+
+	return hash.String(), nil
+}
+
+// Resolve resolves ref against the remote-tracking branches, the tags and the commits
+// of a cloned repository, in that order. An empty ref resolves to the remote's default
+// branch.
+func Resolve(repo *git.Repository, ref string) (plumbing.Hash, error) {
+	var candidates []string
+	if ref == "" {
+		candidates = append(candidates, defaultBranch(repo))
+	} else {
+		candidates = append(candidates,
+			plumbing.NewRemoteReferenceName(git.DefaultRemoteName, ref).String(),
+			plumbing.NewTagReferenceName(ref).String(),
+			ref,
+		)
+	}
+
+	for _, candidate := range candidates {
+		if hash, err := repo.ResolveRevision(plumbing.Revision(candidate)); err == nil {
+			return *hash, nil
+		}
+	}
+
+	if ref == "" {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve default branch: %w", ErrUnknownRef)
+	}
+	return plumbing.ZeroHash, fmt.Errorf("%w %q", ErrUnknownRef, ref)
+}
+
+// checkoutSparse writes the files of the commit below the sparse paths into an emptied
+// working tree and detaches HEAD at the commit. The index is left empty, so a later
+// full checkout starts from scratch.
+func checkoutSparse(repo *git.Repository, root string, hash plumbing.Hash, sparsePaths []string) error {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	if err := repo.Storer.SetIndex(&index.Index{Version: 2}); err != nil {
+		return fmt.Errorf("failed to reset index: %w", err)
+	}
+	if err := clearWorktree(root); err != nil {
+		return err
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if f.Mode == filemode.Symlink || !inSparsePaths(f.Name, sparsePaths) || !filepath.IsLocal(f.Name) {
+			return nil
+		}
+		return writeFile(filepath.Join(root, filepath.FromSlash(f.Name)), f)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write files: %w", err)
+	}
+
+	return repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, hash))
+}
+
+func inSparsePaths(name string, sparsePaths []string) bool {
+	for _, dir := range sparsePaths {
+		dir = strings.Trim(dir, "/")
+		if dir == "" || name == dir || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFile(path string, f *object.File) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	reader, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+// clearWorktree removes everything but the .git directory from the working tree.
+func clearWorktree(root string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return fmt.Errorf("failed to read worktree: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == git.GitDirName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			return fmt.Errorf("failed to clear worktree: %w", err)
+		}
+	}
+	return nil
+}
+
+// defaultBranch returns the remote-tracking reference of the default branch. Right
+// after cloning HEAD points at the default branch; it is recorded as the remote's HEAD
+// so it can still be found once another ref has been checked out.
+func defaultBranch(repo *git.Repository) string {
+	remoteHead := plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+	if ref, err := repo.Reference(remoteHead, false); err == nil {
+		return ref.Target().String()
+	}
+
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil || head.Type() != plumbing.SymbolicReference {
+		return plumbing.HEAD.String()
+	}
+
+	branch := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, head.Target().Short())
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(remoteHead, branch)); err != nil {
+		log.Printf("failed to record default branch: %v", err)
+	}
+	return branch.String()
+}
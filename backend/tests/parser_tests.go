@@ -22,17 +22,18 @@ func TestParseRepository(t *testing.T) {
 
 	patterns := []string{"*.md"}
 
-	p, err := parser.NewParser(textMimeTypes)
+	p, err := parser.NewParser(textMimeTypes, parser.Options{})
 	if err != nil {
 		t.Fatalf("failed to create parser: %v", err)
 	}
 	defer p.Cleanup()
 
 	repoURL := "https://github.com/ben-fornefeld/neo"
-	chunks, err := p.ParseRepository(context.Background(), repoURL, patterns)
+	result, err := p.ParseRepository(context.Background(), repoURL, parser.ParseOptions{IgnorePatterns: patterns})
 	if err != nil {
 		t.Fatalf("failed to parse repository: %v", err)
 	}
+	chunks := result.Chunks
 
 	if len(chunks) == 0 {
 		t.Error("expected chunks to be returned, got empty slice")
@@ -70,7 +71,7 @@ func TestTextFileFilter(t *testing.T) {
 		"application/x-shellscript": true,
 	}
 
-	parser, err := parser.NewParser(textMimeTypes)
+	parser, err := parser.NewParser(textMimeTypes, parser.Options{})
 	if err != nil {
 		t.Fatalf("failed to create parser: %v", err)
 	}
@@ -5,6 +5,11 @@ import type {
   QueryResponseChunk,
   ParsedChunk,
   RankedChunk,
+  FailedChunk,
+  Revision,
+  SkippedFile,
+  ParseWarning,
+  APIError,
 } from "../lib/types";
 import { motion } from "framer-motion";
 import { brutalistSlideMotion } from "../lib/utils";
@@ -13,8 +18,12 @@ import Badge from "./ui/badge";
 interface ChatState {
   isLoading: boolean;
   error?: string;
+  revision?: Revision;
+  skippedFiles: SkippedFile[];
+  warnings: ParseWarning[];
   parsedChunks: ParsedChunk[];
   rankedChunks: RankedChunk[];
+  failedChunks: FailedChunk[];
   completion?: string;
   completionBuffer: string;
 }
@@ -22,8 +31,11 @@ interface ChatState {
 export default function Chat() {
   const [state, setState] = useState<ChatState>({
     isLoading: false,
+    skippedFiles: [],
+    warnings: [],
     parsedChunks: [],
     rankedChunks: [],
+    failedChunks: [],
     completionBuffer: "",
   });
 
@@ -74,8 +86,11 @@ export default function Chat() {
     async (query: string, repopath: string, ignorepatterns: string[]) => {
       setState({
         isLoading: true,
+        skippedFiles: [],
+        warnings: [],
         parsedChunks: [],
         rankedChunks: [],
+        failedChunks: [],
         completionBuffer: "",
       });
 
@@ -100,7 +115,12 @@ export default function Chat() {
         );
 
         if (!response.ok || !response.body) {
-          throw new Error(`HTTP error! status: ${response.status}`);
+          const body: APIError | null = await response
+            .json()
+            .catch(() => null);
+          throw new Error(
+            body?.details || `HTTP error! status: ${response.status}`
+          );
         }
 
         const reader = response.body!.getReader();
@@ -126,6 +146,39 @@ export default function Chat() {
                 const chunk: QueryResponseChunk = JSON.parse(jsonStr);
 
                 switch (chunk.type) {
+                  case "repository.resolved": {
+                    if (chunk.revision) {
+                      setState((prevState) => ({
+                        ...prevState,
+                        revision: chunk.revision,
+                      }));
+                    }
+                    break;
+                  }
+
+                  case "parser.skipped": {
+                    if (chunk.skipped_file) {
+                      setState((prevState) => ({
+                        ...prevState,
+                        skippedFiles: [
+                          ...prevState.skippedFiles,
+                          chunk.skipped_file!,
+                        ],
+                      }));
+                    }
+                    break;
+                  }
+
+                  case "parser.warning": {
+                    if (chunk.warning) {
+                      setState((prevState) => ({
+                        ...prevState,
+                        warnings: [...prevState.warnings, chunk.warning!],
+                      }));
+                    }
+                    break;
+                  }
+
                   case "ranking.parsed": {
                     if (chunk.parsed_chunk) {
                       setState((prevState) => ({
@@ -152,6 +205,19 @@ export default function Chat() {
                     break;
                   }
 
+                  case "ranking.failed": {
+                    if (chunk.failed_chunk) {
+                      setState((prevState) => ({
+                        ...prevState,
+                        failedChunks: [
+                          ...prevState.failedChunks,
+                          chunk.failed_chunk!,
+                        ],
+                      }));
+                    }
+                    break;
+                  }
+
                   case "completion.delta": {
                     if (chunk.completion) {
                       completionQueueRef.current += chunk.completion;
@@ -183,6 +249,39 @@ export default function Chat() {
             const chunk: QueryResponseChunk = JSON.parse(jsonStr);
 
             switch (chunk.type) {
+              case "repository.resolved": {
+                if (chunk.revision) {
+                  setState((prevState) => ({
+                    ...prevState,
+                    revision: chunk.revision,
+                  }));
+                }
+                break;
+              }
+
+              case "parser.skipped": {
+                if (chunk.skipped_file) {
+                  setState((prevState) => ({
+                    ...prevState,
+                    skippedFiles: [
+                      ...prevState.skippedFiles,
+                      chunk.skipped_file!,
+                    ],
+                  }));
+                }
+                break;
+              }
+
+              case "parser.warning": {
+                if (chunk.warning) {
+                  setState((prevState) => ({
+                    ...prevState,
+                    warnings: [...prevState.warnings, chunk.warning!],
+                  }));
+                }
+                break;
+              }
+
               case "ranking.parsed": {
                 if (chunk.parsed_chunk) {
                   setState((prevState) => ({
@@ -209,6 +308,19 @@ export default function Chat() {
                 break;
               }
 
+              case "ranking.failed": {
+                if (chunk.failed_chunk) {
+                  setState((prevState) => ({
+                    ...prevState,
+                    failedChunks: [
+                      ...prevState.failedChunks,
+                      chunk.failed_chunk!,
+                    ],
+                  }));
+                }
+                break;
+              }
+
               case "completion.delta": {
                 if (chunk.completion) {
                   completionQueueRef.current += chunk.completion;
@@ -262,6 +374,46 @@ export default function Chat() {
 
       {state.error && <div className="text-red-500">Error: {state.error}</div>}
 
+      {state.revision && (
+        <div className="text-xs text-gray-500">
+          Answering from {state.revision.ref || "the default branch"} at{" "}
+          {state.revision.commit.slice(0, 12)}
+          {state.revision.base_ref && (
+            <>
+              {" "}
+              reviewing the change from {state.revision.base_ref} at{" "}
+              {state.revision.base_commit?.slice(0, 12)}
+            </>
+          )}
+        </div>
+      )}
+
+      {state.skippedFiles.length > 0 && (
+        <div className="text-xs text-gray-500">
+          {state.skippedFiles.length} files were skipped:
+          <ul>
+            {state.skippedFiles.map((file) => (
+              <li key={file.path}>
+                {file.path}: {file.reason}
+              </li>
+            ))}
+          </ul>
+        </div>
+      )}
+
+      {state.warnings.length > 0 && (
+        <div className="text-xs text-gray-500">
+          {state.warnings.length} files could not be read:
+          <ul>
+            {state.warnings.map((warning) => (
+              <li key={warning.path}>
+                {warning.path}: {warning.message}
+              </li>
+            ))}
+          </ul>
+        </div>
+      )}
+
       {state.parsedChunks.length > 0 && (
         <motion.div
           variants={brutalistSlideMotion}
@@ -286,14 +438,21 @@ export default function Chat() {
           </p>
           {state.rankedChunks.map((chunk) => (
             <Badge
-              key={chunk.ParsedChunk.FilePath}
-              text={chunk.ParsedChunk.FilePath}
+              key={chunk.ParsedChunk.ID}
+              text={`${chunk.ParsedChunk.FilePath}:${chunk.ParsedChunk.StartLine}-${chunk.ParsedChunk.EndLine}`}
               className="text-xs whitespace-nowrap"
             />
           ))}
         </motion.div>
       )}
 
+      {state.failedChunks.length > 0 && (
+        <div className="text-xs text-gray-500">
+          {state.failedChunks.length} chunks could not be ranked and were
+          skipped.
+        </div>
+      )}
+
       {state.completion && (
         <RenderCompletion completion={state.completion || ""} />
       )}
@@ -1,23 +1,82 @@
 export type QueryEventType =
+  | "repository.resolved"
+  | "parser.skipped"
+  | "parser.warning"
   | "ranking.parsed"
   | "ranking.ranked"
+  | "ranking.failed"
   | "completion.delta"
   | "error";
 
+export interface Revision {
+  url: string;
+  ref: string;
+  commit: string;
+  base_ref?: string;
+  base_commit?: string;
+}
+
+export interface SkippedFile {
+  path: string;
+  reason: string;
+}
+
+export interface ParseWarning {
+  path: string;
+  message: string;
+}
+
+export interface APIError {
+  error: string;
+  code: number;
+  details?: string;
+}
+
+export interface CommitInfo {
+  Hash: string;
+  Author: string;
+  Date: string;
+  Message: string;
+}
+
 export interface ParsedChunk {
+  ID: string;
   FilePath: string;
   Content: string;
+  Language: string;
+  StartLine: number;
+  EndLine: number;
+  StartByte: number;
+  EndByte: number;
+  LastCommit: CommitInfo | null;
+  Hunk: boolean;
+}
+
+export interface Usage {
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
 }
 
 export interface RankedChunk {
   ParsedChunk: ParsedChunk;
   Score: number;
+  Usage: Usage;
+}
+
+export interface FailedChunk {
+  ParsedChunk: ParsedChunk;
+  Reason: string;
 }
 
 export interface QueryResponseChunk {
   type: QueryEventType;
+  revision?: Revision;
+  skipped_file?: SkippedFile;
+  warning?: ParseWarning;
   parsed_chunk?: ParsedChunk;
   ranked_chunk?: RankedChunk;
+  failed_chunk?: FailedChunk;
   completion?: string;
   error?: string;
 }